@@ -0,0 +1,142 @@
+/*
+ * BSD-3-Clause
+ * Copyright 2020 sot (PR_713, C_rho_272)
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ * 1. Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ * this list of conditions and the following disclaimer in the documentation and/or
+ * other materials provided with the distribution.
+ * 3. Neither the name of the copyright holder nor the names of its contributors
+ * may be used to endorse or promote products derived from this software without
+ * specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+ * IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+ * BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+ * OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+ * WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY
+ * OF SUCH DAMAGE.
+ */
+
+package TtKVC
+
+import (
+	"strconv"
+	"strings"
+	tmpl "text/template"
+)
+
+func (cr *Observer) initCategories() error {
+	var err error
+	cr.Kaltura.categoriesTmpl = make([]*tmpl.Template, 0, len(cr.Kaltura.Categories))
+	for i, category := range cr.Kaltura.Categories {
+		var t *tmpl.Template
+		if t, err = tmpl.New("category" + strconv.Itoa(i)).Parse(category); err != nil {
+			return err
+		}
+		cr.Kaltura.categoriesTmpl = append(cr.Kaltura.categoriesTmpl, t)
+	}
+	if !isEmpty(cr.Kaltura.Playlist) {
+		cr.Kaltura.playlistTmpl, err = tmpl.New("playlist").Parse(cr.Kaltura.Playlist)
+	}
+	return err
+}
+
+func splitCategoryPath(path string) []string {
+	var res []string
+	for _, name := range strings.Split(path, "/") {
+		if name = strings.TrimSpace(name); !isEmpty(name) {
+			res = append(res, strings.ReplaceAll(name, kCategoryDelimiter, " "))
+		}
+	}
+	return res
+}
+
+func (cr *Observer) torrentTemplateData(torrent int64, hash string) (map[string]interface{}, error) {
+	var err error
+	var name string
+	var meta map[string]string
+	if meta, err = cr.DB.GetTorrentMeta(torrent); err == nil {
+		name, err = cr.DB.GetTorrentName(torrent)
+	}
+	return map[string]interface{}{
+		pMeta: meta,
+		pName: name,
+		pHash: hash,
+	}, err
+}
+
+func (cr *Observer) assignCategories(file TorrentFile, entryId string) error {
+	if len(cr.Kaltura.categoriesTmpl) == 0 {
+		return nil
+	}
+	data, err := cr.torrentTemplateData(file.Torrent, file.TorrentHash)
+	if err != nil {
+		return err
+	}
+	for _, t := range cr.Kaltura.categoriesTmpl {
+		var path string
+		if path, err = formatMessage(t, data); err != nil {
+			break
+		}
+		names := splitCategoryPath(path)
+		if len(names) == 0 {
+			continue
+		}
+		var categoryId int64
+		if categoryId, err = cr.Kaltura.GetOrCreateCategory(names); err == nil {
+			logger.Debugf("Adding entry %s to category %s", entryId, strings.Join(names, kCategoryDelimiter))
+			err = cr.Kaltura.AddEntryToCategory(entryId, categoryId)
+		}
+		if err != nil {
+			break
+		}
+	}
+	return err
+}
+
+func (cr *Observer) updatePlaylist(file TorrentFile) error {
+	if cr.Kaltura.playlistTmpl == nil {
+		return nil
+	}
+	cr.playlistMutex.Lock()
+	defer cr.playlistMutex.Unlock()
+	var err error
+	var files []TorrentFile
+	var playlistId string
+	if files, err = cr.DB.GetTorrentFiles(file.Torrent); err != nil {
+		return err
+	}
+	entries := make([]string, 0, len(files))
+	for _, f := range files {
+		if !isEmpty(f.EntryId) && (f.Status == FileConvertingStatus || f.Status == FileReadyStatus) {
+			entries = append(entries, f.EntryId)
+		}
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	if playlistId, err = cr.DB.GetTorrentPlaylist(file.Torrent); err == nil {
+		var name string
+		if isEmpty(playlistId) {
+			var data map[string]interface{}
+			if data, err = cr.torrentTemplateData(file.Torrent, file.TorrentHash); err == nil {
+				name, err = formatMessage(cr.Kaltura.playlistTmpl, data)
+			}
+		}
+		if err == nil {
+			var newId string
+			if newId, err = cr.Kaltura.SetPlaylist(playlistId, name, entries); err == nil && newId != playlistId {
+				logger.Debug("Created playlist", newId, "for torrent", file.Torrent)
+				err = cr.DB.SetTorrentPlaylist(file.Torrent, newId)
+			}
+		}
+	}
+	return err
+}
@@ -0,0 +1,99 @@
+/*
+ * BSD-3-Clause
+ * Copyright 2020 sot (PR_713, C_rho_272)
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ * 1. Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ * this list of conditions and the following disclaimer in the documentation and/or
+ * other materials provided with the distribution.
+ * 3. Neither the name of the copyright holder nor the names of its contributors
+ * may be used to endorse or promote products derived from this software without
+ * specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+ * IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+ * BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+ * OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+ * WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY
+ * OF SUCH DAMAGE.
+ */
+
+package TtKVC
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	ClientTransmission = "transmission"
+	ClientQBittorrent  = "qbittorrent"
+	ClientDeluge       = "deluge"
+)
+
+type TorrentClient interface {
+	GetTorrents() ([]ClientTorrent, error)
+	RemoveTorrents(ids []string) error
+	AddTorrent(metaInfo []byte, path string) (ClientTorrent, error)
+	AddMagnet(uri string, path string) (ClientTorrent, error)
+	AddTrackers(ids []string, trackers []string) error
+	GetProgress(id string) (float64, error)
+	GetFiles(id string) ([]ClientFile, error)
+}
+
+type ClientTorrent struct {
+	Id       string
+	Name     string
+	Hash     string
+	Progress float64
+}
+
+type ClientFile struct {
+	Name     string
+	Length   int64
+	Progress float64
+}
+
+func (f ClientFile) Complete() bool {
+	return f.Progress >= 1
+}
+
+type TorrentClientConfig struct {
+	Type       string `json:"type"`
+	Host       string `json:"host"`
+	Port       uint16 `json:"port"`
+	Login      string `json:"login"`
+	Password   string `json:"password"`
+	Encryption bool   `json:"encryption"`
+}
+
+func (c TorrentClientConfig) baseURL() string {
+	scheme := "http"
+	if c.Encryption {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s:%d", scheme, c.Host, c.Port)
+}
+
+func NewTorrentClient(conf TorrentClientConfig) (TorrentClient, error) {
+	if isEmpty(conf.Host) || conf.Port == 0 {
+		return nil, errors.New("invalid torrent client connection data")
+	}
+	switch strings.ToLower(conf.Type) {
+	case "", ClientTransmission:
+		return newTransmissionClient(conf)
+	case ClientQBittorrent:
+		return newQBittorrentClient(conf)
+	case ClientDeluge:
+		return newDelugeClient(conf)
+	default:
+		return nil, errors.New("unsupported torrent client type " + conf.Type)
+	}
+}
@@ -0,0 +1,94 @@
+/*
+ * BSD-3-Clause
+ * Copyright 2020 sot (PR_713, C_rho_272)
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ * 1. Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ * this list of conditions and the following disclaimer in the documentation and/or
+ * other materials provided with the distribution.
+ * 3. Neither the name of the copyright holder nor the names of its contributors
+ * may be used to endorse or promote products derived from this software without
+ * specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+ * IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+ * BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+ * OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+ * WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY
+ * OF SUCH DAMAGE.
+ */
+
+package TtKVC
+
+import (
+	"github.com/zeebo/bencode"
+	"net"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func testClientConfig(t *testing.T, server *httptest.Server, clientType string) TorrentClientConfig {
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return TorrentClientConfig{
+		Type:     clientType,
+		Host:     host,
+		Port:     uint16(p),
+		Login:    "user",
+		Password: "secret",
+	}
+}
+
+func testMetaInfo(t *testing.T) ([]byte, string) {
+	metaInfo, err := bencode.EncodeBytes(map[string]interface{}{
+		"announce": "http://tracker.local/announce",
+		"info": map[string]interface{}{
+			"name":         "test.mkv",
+			"length":       1024,
+			"piece length": 16384,
+			"pieces":       "01234567890123456789",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := infoHash(metaInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return metaInfo, hash
+}
+
+func TestNewTorrentClientInvalid(t *testing.T) {
+	if c, err := NewTorrentClient(TorrentClientConfig{}); err == nil || c != nil {
+		t.Error("expected error and nil client for empty config, got", c, err)
+	}
+	if c, err := NewTorrentClient(TorrentClientConfig{Type: "unknown", Host: "localhost", Port: 1}); err == nil || c != nil {
+		t.Error("expected error and nil client for unknown type, got", c, err)
+	}
+}
+
+func TestNewTorrentClientUnreachable(t *testing.T) {
+	server := httptest.NewServer(nil)
+	conf := testClientConfig(t, server, ClientQBittorrent)
+	server.Close()
+	for _, clientType := range []string{ClientQBittorrent, ClientDeluge} {
+		conf.Type = clientType
+		if c, err := NewTorrentClient(conf); err == nil || c != nil {
+			t.Errorf("%s: expected error and nil client, got %v %v", clientType, c, err)
+		}
+	}
+}
@@ -0,0 +1,475 @@
+/*
+ * BSD-3-Clause
+ * Copyright 2020 sot (PR_713, C_rho_272)
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ * 1. Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ * this list of conditions and the following disclaimer in the documentation and/or
+ * other materials provided with the distribution.
+ * 3. Neither the name of the copyright holder nor the names of its contributors
+ * may be used to endorse or promote products derived from this software without
+ * specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+ * IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+ * BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+ * OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+ * WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY
+ * OF SUCH DAMAGE.
+ */
+
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"github.com/op/go-logging"
+	"html/template"
+	"net/http"
+	"net/url"
+	"sot-te.ch/TtKVC"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 1000
+
+	httpReadTimeout  = 30 * time.Second
+	httpWriteTimeout = 2 * time.Minute
+	httpIdleTimeout  = 2 * time.Minute
+
+	dashboardTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>TtKVC {{.Version}}</title>
+<style>
+body { font-family: sans-serif; font-size: 14px; margin: 1em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 2px 6px; text-align: left; }
+form { display: inline; }
+.error { color: #c00; }
+</style>
+</head>
+<body>
+<h1><a href="/">TtKVC {{.Version}}</a></h1>
+{{if .Torrent}}
+{{with .Torrent}}
+<h2>{{.Name}}</h2>
+<table>
+<tr><th>Id</th><td>{{.Id}}</td></tr>
+<tr><th>Hash</th><td>{{.Hash}}</td></tr>
+<tr><th>Source</th><td>{{.Source}}</td></tr>
+<tr><th>Offset</th><td>{{.Offset}}</td></tr>
+{{if .Magnet}}<tr><th>Magnet</th><td>{{.Magnet}}</td></tr>{{end}}
+<tr><th>Files</th><td>{{.Ready}}/{{.Files}}</td></tr>
+</table>
+{{end}}
+{{if .Meta}}
+<h3>Meta</h3>
+<table>
+{{range $k, $v := .Meta}}<tr><th>{{$k}}</th><td>{{$v}}</td></tr>
+{{end}}
+</table>
+{{end}}
+<h3>Files</h3>
+{{template "files" .}}
+{{else}}
+<h2>Sources</h2>
+<table>
+<tr><th>Name</th><th>Next index</th><th>Torrents</th><th>Pending files</th></tr>
+{{range .Sources}}<tr><td>{{.Name}}</td><td>{{.Offset}}</td><td>{{.Torrents}}</td><td>{{.Pending}}</td></tr>
+{{end}}
+</table>
+<form method="post" action="/api/check">
+<input type="hidden" name="back" value="/">
+<select name="source">{{range .SourceNames}}<option>{{.}}</option>{{end}}</select>
+<input type="number" name="offset" min="0" placeholder="offset" required>
+<input type="submit" value="Force check">
+</form>
+<h2>Pending files</h2>
+{{template "files" .}}
+<h2>Torrents</h2>
+<table>
+<tr><th>Id</th><th>Name</th><th>Hash</th><th>Source</th><th>Offset</th><th>Files</th></tr>
+{{range .Torrents}}<tr><td>{{.Id}}</td><td><a href="/torrent?id={{.Id}}">{{.Name}}</a></td><td>{{.Hash}}</td><td>{{.Source}}</td><td>{{.Offset}}</td><td>{{.Ready}}/{{.Files}}</td></tr>
+{{end}}
+</table>
+{{if .Next}}<a href="/?offset={{.Next}}">Next page</a>{{end}}
+{{end}}
+</body>
+</html>
+{{define "files"}}
+<table>
+<tr><th>Id</th><th>Name</th><th>Status</th><th>Progress</th><th>Entry id</th><th>Attempts</th><th>Last error</th><th></th></tr>
+{{$back := .Back}}
+{{range .Files}}{{$status := status .Status}}<tr>
+<td>{{.Id}}</td>
+<td><a href="/torrent?id={{.Torrent}}">{{.Name}}</a></td>
+<td{{if eq $status "error"}} class="error"{{end}}>{{$status}}</td>
+<td>{{percent .Progress}}</td>
+<td>{{.EntryId}}</td>
+<td>{{.Attempts}}</td>
+<td>{{.LastError}}</td>
+<td>
+{{if eq $status "error"}}<form method="post" action="/api/retry"><input type="hidden" name="id" value="{{.Id}}"><input type="hidden" name="back" value="{{$back}}"><input type="submit" value="Retry"></form>{{end}}
+{{if or (eq $status "converting") (eq $status "ready")}}<form method="post" action="/api/ignore"><input type="hidden" name="id" value="{{.Id}}"><input type="hidden" name="back" value="{{$back}}"><input type="submit" value="Switch ignore"></form>{{end}}
+{{if eq $status "ready"}}<form method="post" action="/api/resend"><input type="hidden" name="id" value="{{.Id}}"><input type="hidden" name="back" value="{{$back}}"><input type="submit" value="Resend"></form>{{end}}
+</td>
+</tr>
+{{end}}
+</table>
+{{end}}`
+)
+
+var httpLogger = logging.MustGetLogger("http")
+
+type httpServer struct {
+	observer  *TtKVC.Observer
+	dashboard *template.Template
+}
+
+type torrentResponse struct {
+	TtKVC.TorrentInfo
+	Files []TtKVC.TorrentFile
+	Meta  map[string]string
+}
+
+func fileStatusName(status uint8) string {
+	switch status {
+	case TtKVC.FilePendingStatus:
+		return "pending"
+	case TtKVC.FileConvertingStatus:
+		return "converting"
+	case TtKVC.FileReadyStatus:
+		return "ready"
+	case TtKVC.FileDownloadingStatus:
+		return "downloading"
+	case TtKVC.FileErrorStatus:
+		return "error"
+	default:
+		return strconv.FormatUint(uint64(status), 10)
+	}
+}
+
+func newHTTPHandler(observer *TtKVC.Observer) (http.Handler, error) {
+	conf := observer.HTTP
+	if len(conf.Token) == 0 && (len(conf.Login) == 0 || len(conf.Password) == 0) {
+		return nil, errors.New("http token or login and password not set")
+	}
+	dashboard, err := template.New("dashboard").Funcs(template.FuncMap{
+		"status": fileStatusName,
+		"percent": func(progress float64) string {
+			return strconv.FormatFloat(progress*100, 'f', 1, 64) + "%"
+		},
+	}).Parse(dashboardTemplate)
+	if err != nil {
+		return nil, err
+	}
+	server := &httpServer{
+		observer:  observer,
+		dashboard: dashboard,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", server.handleDashboard)
+	mux.HandleFunc("/torrent", server.handleTorrentPage)
+	mux.HandleFunc("/api/state", server.handleState)
+	mux.HandleFunc("/api/torrents", server.handleTorrents)
+	mux.HandleFunc("/api/torrent", server.handleTorrent)
+	mux.HandleFunc("/api/files", server.handleFiles)
+	mux.HandleFunc("/api/check", server.post(server.handleCheck))
+	mux.HandleFunc("/api/ignore", server.post(server.handleIgnore))
+	mux.HandleFunc("/api/retry", server.post(server.handleRetry))
+	mux.HandleFunc("/api/resend", server.post(server.handleResend))
+	return server.auth(mux), nil
+}
+
+func startHTTP(observer *TtKVC.Observer) error {
+	handler, err := newHTTPHandler(observer)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{
+		Addr:         observer.HTTP.Listen,
+		Handler:      handler,
+		ReadTimeout:  httpReadTimeout,
+		WriteTimeout: httpWriteTimeout,
+		IdleTimeout:  httpIdleTimeout,
+	}
+	httpLogger.Info("Starting HTTP server on", server.Addr)
+	return server.ListenAndServe()
+}
+
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+func (s *httpServer) auth(next http.Handler) http.Handler {
+	conf := s.observer.HTTP
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorized := false
+		if len(conf.Token) > 0 {
+			if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+				authorized = secureEqual(strings.TrimPrefix(auth, "Bearer "), conf.Token)
+			}
+		}
+		if !authorized && len(conf.Login) > 0 && len(conf.Password) > 0 {
+			if login, password, ok := r.BasicAuth(); ok {
+				authorized = secureEqual(login, conf.Login) && secureEqual(password, conf.Password)
+			}
+		}
+		if !authorized {
+			if len(conf.Login) > 0 {
+				w.Header().Set("WWW-Authenticate", `Basic realm="TtKVC"`)
+			}
+			writeError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *httpServer) post(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+		if origin := r.Header.Get("Origin"); len(origin) > 0 {
+			if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+				writeError(w, http.StatusForbidden, errors.New("cross-origin request denied"))
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		httpLogger.Error(err)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	if err = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()}); err != nil {
+		httpLogger.Error(err)
+	}
+}
+
+func writeResult(w http.ResponseWriter, r *http.Request, err error) {
+	if err != nil {
+		httpLogger.Warning(err)
+		writeError(w, http.StatusBadRequest, err)
+	} else if back := r.FormValue("back"); strings.HasPrefix(back, "/") && !strings.HasPrefix(back, "//") {
+		http.Redirect(w, r, back, http.StatusSeeOther)
+	} else {
+		writeJSON(w, map[string]bool{"ok": true})
+	}
+}
+
+func formUint(r *http.Request, name string, def uint) (uint, error) {
+	val := r.FormValue(name)
+	if len(val) == 0 {
+		return def, nil
+	}
+	res, err := strconv.ParseUint(val, 10, 32)
+	return uint(res), err
+}
+
+func formId(r *http.Request) (int64, error) {
+	return strconv.ParseInt(r.FormValue("id"), 10, 64)
+}
+
+func pageParams(r *http.Request) (uint, uint, error) {
+	var err error
+	var limit, offset uint
+	if limit, err = formUint(r, "limit", defaultPageLimit); err == nil {
+		if limit == 0 || limit > maxPageLimit {
+			limit = maxPageLimit
+		}
+		offset, err = formUint(r, "offset", 0)
+	}
+	return limit, offset, err
+}
+
+func (s *httpServer) getTorrent(id int64) (torrentResponse, error) {
+	var err error
+	res := torrentResponse{}
+	if res.TorrentInfo, err = s.observer.DB.GetTorrentInfo(id); err == nil {
+		if res.Id == TtKVC.TorrentInvalidId {
+			err = errors.New("no such torrent")
+		} else if res.Files, err = s.observer.DB.GetTorrentFiles(id); err == nil {
+			res.Meta, err = s.observer.DB.GetTorrentMeta(id)
+		}
+	}
+	return res, err
+}
+
+func (s *httpServer) handleState(w http.ResponseWriter, _ *http.Request) {
+	if sources, err := s.observer.DB.GetSourcesState(); err == nil {
+		writeJSON(w, map[string]interface{}{
+			"version": TtKVC.Version,
+			"sources": sources,
+		})
+	} else {
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+func (s *httpServer) handleTorrents(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := pageParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if torrents, err := s.observer.DB.GetTorrents(limit, offset); err == nil {
+		writeJSON(w, torrents)
+	} else {
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+func (s *httpServer) handleTorrent(w http.ResponseWriter, r *http.Request) {
+	id, err := formId(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if torrent, err := s.getTorrent(id); err == nil {
+		writeJSON(w, torrent)
+	} else {
+		writeError(w, http.StatusNotFound, err)
+	}
+}
+
+func (s *httpServer) handleFiles(w http.ResponseWriter, _ *http.Request) {
+	if files, err := s.observer.DB.GetTorrentFilesNotReady(); err == nil {
+		writeJSON(w, files)
+	} else {
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+func (s *httpServer) handleCheck(w http.ResponseWriter, r *http.Request) {
+	offset, err := formUint(r, "offset", 0)
+	if err == nil {
+		if len(r.FormValue("offset")) == 0 {
+			err = errors.New("offset not set")
+		} else {
+			err = s.observer.ForceCheck(r.FormValue("source"), offset)
+		}
+	}
+	writeResult(w, r, err)
+}
+
+func (s *httpServer) handleIgnore(w http.ResponseWriter, r *http.Request) {
+	id, err := formId(r)
+	if err == nil {
+		var admins []int64
+		if admins, err = s.observer.DB.GetAdmins(); err == nil {
+			err = s.observer.SwitchFileIgnore(id, admins)
+		}
+	}
+	writeResult(w, r, err)
+}
+
+func (s *httpServer) handleRetry(w http.ResponseWriter, r *http.Request) {
+	id, err := formId(r)
+	if err == nil {
+		err = s.observer.RetryFile(id)
+	}
+	writeResult(w, r, err)
+}
+
+func (s *httpServer) handleResend(w http.ResponseWriter, r *http.Request) {
+	var chat int64
+	id, err := formId(r)
+	if err == nil && len(r.FormValue("chat")) > 0 {
+		chat, err = strconv.ParseInt(r.FormValue("chat"), 10, 64)
+	}
+	if err == nil {
+		err = s.observer.ResendFile(id, chat)
+	}
+	writeResult(w, r, err)
+}
+
+func (s *httpServer) renderDashboard(w http.ResponseWriter, data map[string]interface{}) {
+	data["Version"] = TtKVC.Version
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := s.dashboard.Execute(w, data); err != nil {
+		httpLogger.Error(err)
+	}
+}
+
+func (s *httpServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	limit, offset, err := pageParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	data := map[string]interface{}{
+		"Back": r.URL.RequestURI(),
+	}
+	var sources []TtKVC.SourceState
+	var files []TtKVC.TorrentFile
+	var torrents []TtKVC.TorrentInfo
+	if sources, err = s.observer.DB.GetSourcesState(); err == nil {
+		if files, err = s.observer.DB.GetTorrentFilesNotReady(); err == nil {
+			torrents, err = s.observer.DB.GetTorrents(limit, offset)
+		}
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	sourceNames := make([]string, 0, len(s.observer.Crawler.Sources))
+	for _, src := range s.observer.Crawler.Sources {
+		sourceNames = append(sourceNames, src.Name)
+	}
+	data["Sources"] = sources
+	data["SourceNames"] = sourceNames
+	data["Files"] = files
+	data["Torrents"] = torrents
+	if uint(len(torrents)) == limit {
+		data["Next"] = offset + limit
+	}
+	s.renderDashboard(w, data)
+}
+
+func (s *httpServer) handleTorrentPage(w http.ResponseWriter, r *http.Request) {
+	id, err := formId(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var torrent torrentResponse
+	if torrent, err = s.getTorrent(id); err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	s.renderDashboard(w, map[string]interface{}{
+		"Back":    r.URL.RequestURI(),
+		"Torrent": torrent.TorrentInfo,
+		"Meta":    torrent.Meta,
+		"Files":   torrent.Files,
+	})
+}
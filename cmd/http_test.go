@@ -0,0 +1,137 @@
+/*
+ * BSD-3-Clause
+ * Copyright 2020 sot (PR_713, C_rho_272)
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ * 1. Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ * this list of conditions and the following disclaimer in the documentation and/or
+ * other materials provided with the distribution.
+ * 3. Neither the name of the copyright holder nor the names of its contributors
+ * may be used to endorse or promote products derived from this software without
+ * specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+ * IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+ * BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+ * OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+ * WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY
+ * OF SUCH DAMAGE.
+ */
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sot-te.ch/TtKVC"
+	"strings"
+	"testing"
+)
+
+func testHTTPServer(t *testing.T, token, login, password string) *httptest.Server {
+	observer := new(TtKVC.Observer)
+	observer.HTTP.Token = token
+	observer.HTTP.Login = login
+	observer.HTTP.Password = password
+	handler, err := newHTTPHandler(observer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return httptest.NewServer(handler)
+}
+
+func TestNewHTTPHandlerNoAuth(t *testing.T) {
+	if _, err := newHTTPHandler(new(TtKVC.Observer)); err == nil {
+		t.Error("expected error without token and login")
+	}
+	observer := new(TtKVC.Observer)
+	observer.HTTP.Login = "admin"
+	if _, err := newHTTPHandler(observer); err == nil {
+		t.Error("expected error without password")
+	}
+}
+
+func TestHTTPAuth(t *testing.T) {
+	server := testHTTPServer(t, "secret", "admin", "pass")
+	defer server.Close()
+	tests := []struct {
+		name   string
+		setup  func(r *http.Request)
+		status int
+	}{
+		{name: "no auth", setup: func(r *http.Request) {}, status: http.StatusUnauthorized},
+		{name: "token", setup: func(r *http.Request) { r.Header.Set("Authorization", "Bearer secret") }, status: http.StatusBadRequest},
+		{name: "wrong token", setup: func(r *http.Request) { r.Header.Set("Authorization", "Bearer wrong") }, status: http.StatusUnauthorized},
+		{name: "basic", setup: func(r *http.Request) { r.SetBasicAuth("admin", "pass") }, status: http.StatusBadRequest},
+		{name: "wrong basic", setup: func(r *http.Request) { r.SetBasicAuth("admin", "wrong") }, status: http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, server.URL+"/api/retry", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.setup(req)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != test.status {
+				t.Error("unexpected status", resp.StatusCode)
+			}
+			if test.status == http.StatusUnauthorized && len(resp.Header.Get("WWW-Authenticate")) == 0 {
+				t.Error("basic auth challenge not set")
+			}
+		})
+	}
+}
+
+func TestHTTPPostOrigin(t *testing.T) {
+	server := testHTTPServer(t, "secret", "", "")
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		method string
+		origin string
+		status int
+	}{
+		{name: "get", method: http.MethodGet, status: http.StatusMethodNotAllowed},
+		{name: "no origin", method: http.MethodPost, status: http.StatusBadRequest},
+		{name: "same origin", method: http.MethodPost, origin: server.URL, status: http.StatusBadRequest},
+		{name: "foreign origin", method: http.MethodPost, origin: "http://evil.local", status: http.StatusForbidden},
+		{name: "foreign port", method: http.MethodPost, origin: "http://" + serverURL.Hostname() + ":1", status: http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest(test.method, server.URL+"/api/retry", strings.NewReader("id=x"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.Header.Set("Authorization", "Bearer secret")
+			if len(test.origin) > 0 {
+				req.Header.Set("Origin", test.origin)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != test.status {
+				t.Error("unexpected status", resp.StatusCode)
+			}
+		})
+	}
+}
@@ -76,6 +76,13 @@ func main() {
 	logger.Info("Starting TtKVC", TtKVC.Version)
 	if err := crawler.Init(); err == nil {
 		go crawler.Engage()
+		if len(crawler.HTTP.Listen) > 0 {
+			go func() {
+				if err := startHTTP(crawler); err != nil {
+					logger.Error(err)
+				}
+			}()
+		}
 		ch := make(chan os.Signal, 2)
 		signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
 		<-ch
@@ -32,6 +32,7 @@ import (
 	"fmt"
 	_ "github.com/mattn/go-sqlite3"
 	"strconv"
+	"time"
 )
 
 type Database struct {
@@ -52,22 +53,66 @@ const (
 	delAdmin     = "DELETE FROM TT_ADMIN WHERE ID = $1"
 	existAdmin   = "SELECT 1 FROM TT_ADMIN WHERE ID = $1"
 
-	selectTorrentId       = "SELECT ID FROM TT_TORRENT WHERE NAME = $1"
-	selectTorrentOffset   = "SELECT OFFSET FROM TT_TORRENT WHERE ID = $1"
-	insertOrUpdateTorrent = "INSERT INTO TT_TORRENT(NAME, OFFSET) VALUES ($1, $2) ON CONFLICT(NAME) DO UPDATE SET OFFSET = EXCLUDED.OFFSET"
+	selectTorrentId      = "SELECT ID FROM TT_TORRENT WHERE HASH = $1 AND HASH != '' UNION ALL SELECT ID FROM TT_TORRENT WHERE HASH = '' AND NAME = $2 LIMIT 1"
+	selectTorrentName    = "SELECT NAME FROM TT_TORRENT WHERE ID = $1"
+	selectTorrentHash    = "SELECT HASH FROM TT_TORRENT WHERE ID = $1"
+	selectTorrentsByName = "SELECT ID FROM TT_TORRENT WHERE NAME = $1 AND SOURCE = $2 AND HASH != $3 ORDER BY ID DESC"
+	selectTorrentOffset  = "SELECT OFFSET FROM TT_TORRENT WHERE ID = $1"
+	selectTorrentsInfo   = "SELECT T.ID, T.NAME, T.HASH, COALESCE(S.NAME, ''), T.OFFSET, T.MAGNET, COUNT(F.ID), COALESCE(SUM(CASE WHEN F.READY = $1 THEN 1 ELSE 0 END), 0) " +
+		"FROM TT_TORRENT T LEFT JOIN TT_SOURCE S ON S.ID = T.SOURCE LEFT JOIN TT_TORRENT_FILE F ON F.TORRENT = T.ID"
+	selectTorrents        = selectTorrentsInfo + " GROUP BY T.ID ORDER BY T.ID DESC LIMIT $2 OFFSET $3"
+	selectTorrentInfo     = selectTorrentsInfo + " WHERE T.ID = $2 GROUP BY T.ID"
+	selectTorrentPlaylist = "SELECT PLAYLIST_ID FROM TT_TORRENT WHERE ID = $1"
+	setTorrentPlaylist    = "UPDATE TT_TORRENT SET PLAYLIST_ID = $1 WHERE ID = $2"
+	selectTorrentMagnets  = "SELECT T.ID, T.NAME, T.MAGNET FROM TT_TORRENT T WHERE T.MAGNET != '' AND NOT EXISTS (SELECT 1 FROM TT_TORRENT_FILE F WHERE F.TORRENT = T.ID)"
+	setTorrentMagnet      = "UPDATE TT_TORRENT SET MAGNET = $1 WHERE ID = $2"
+	setTorrentName        = "UPDATE TT_TORRENT SET NAME = $1 WHERE ID = $2"
+	insertTorrent         = "INSERT INTO TT_TORRENT(NAME, HASH, SOURCE, OFFSET) VALUES ($1, $2, $3, $4)"
+	updateTorrent         = "UPDATE TT_TORRENT SET NAME = $1, HASH = $2, SOURCE = $3, OFFSET = $4 WHERE ID = $5"
+
+	selectSourceId     = "SELECT ID FROM TT_SOURCE WHERE NAME = $1"
+	selectSourceOffset = "SELECT OFFSET FROM TT_SOURCE WHERE ID = $1"
+	selectSourcesCount = "SELECT COUNT(*) FROM TT_SOURCE"
+	selectSourcesState = "SELECT S.NAME, S.OFFSET, COUNT(DISTINCT T.ID), COALESCE(SUM(CASE WHEN F.READY != $1 THEN 1 ELSE 0 END), 0) " +
+		"FROM TT_SOURCE S LEFT JOIN TT_TORRENT T ON T.SOURCE = S.ID LEFT JOIN TT_TORRENT_FILE F ON F.TORRENT = T.ID " +
+		"GROUP BY S.ID, S.NAME, S.OFFSET ORDER BY S.ID"
+	insertSource    = "INSERT INTO TT_SOURCE(NAME, OFFSET) VALUES ($1, $2)"
+	setSourceOffset = "UPDATE TT_SOURCE SET OFFSET = $1 WHERE ID = $2"
+
+	existFeedItem  = "SELECT 1 FROM TT_FEED_ITEM WHERE SOURCE = $1 AND GUID = $2"
+	insertFeedItem = "INSERT INTO TT_FEED_ITEM(SOURCE, GUID) VALUES ($1, $2) ON CONFLICT(SOURCE, GUID) DO NOTHING"
 
 	selectTorrentMeta = "SELECT NAME, VALUE FROM TT_TORRENT_META WHERE TORRENT = $1"
 	insertTorrentMeta = "INSERT INTO TT_TORRENT_META(TORRENT, NAME, VALUE) VALUES($1, $2, $3) ON CONFLICT(TORRENT,NAME) DO UPDATE SET VALUE = EXCLUDED.VALUE"
 
-	selectTorrentFiles          = "SELECT ID, TORRENT, NAME, ENTRY_ID, READY, ROW_NUMBER() OVER(ORDER BY NAME) AS IND FROM TT_TORRENT_FILE"
-	selectTorrentFileById       = selectTorrentFiles + " WHERE ID = $1"
-	selectTorrentFilesByTorrent = selectTorrentFiles + " WHERE TORRENT = $1 ORDER BY NAME"
-	selectTorrentFilesNotReady  = selectTorrentFiles + " WHERE READY != $1 ORDER BY NAME"
+	selectTorrentFiles = "SELECT F.ID AS ID, F.TORRENT, F.NAME, F.ENTRY_ID, F.READY, F.PROGRESS, F.LENGTH, F.HASH, F.ATTEMPTS, F.LAST_ERROR, F.NEXT_RETRY, F.UPLOAD_TOKEN, F.UPLOAD_OFFSET, T.HASH, COALESCE(T.SOURCE, 0), ROW_NUMBER() OVER(ORDER BY F.NAME) AS IND " +
+		"FROM TT_TORRENT_FILE F JOIN TT_TORRENT T ON T.ID = F.TORRENT"
+	selectTorrentFileById       = selectTorrentFiles + " WHERE F.ID = $1"
+	selectTorrentFilesByTorrent = selectTorrentFiles + " WHERE F.TORRENT = $1 ORDER BY F.NAME"
+	selectTorrentFilesNotReady  = selectTorrentFiles + " WHERE F.READY != $1 ORDER BY F.NAME"
 
 	selectTorrentFileIndex = "SELECT IND FROM (" + selectTorrentFilesByTorrent + ") WHERE ID = $2"
-	insertTorrentFile      = "INSERT INTO TT_TORRENT_FILE(TORRENT, NAME) VALUES ($1, $2) ON CONFLICT (TORRENT,NAME) DO NOTHING"
+	insertTorrentFile      = "INSERT INTO TT_TORRENT_FILE(TORRENT, NAME, LENGTH, HASH) VALUES ($1, $2, $3, $4) ON CONFLICT (TORRENT,NAME) DO UPDATE SET LENGTH = EXCLUDED.LENGTH, HASH = EXCLUDED.HASH"
+	resetTorrentFile       = "UPDATE TT_TORRENT_FILE SET READY = $1, PROGRESS = 0, ENTRY_ID = '', ATTEMPTS = 0, LAST_ERROR = '', NEXT_RETRY = 0, UPLOAD_TOKEN = '', UPLOAD_OFFSET = 0 WHERE ID = $2"
+	retryTorrentFile       = "UPDATE TT_TORRENT_FILE SET READY = $1, ATTEMPTS = 0, NEXT_RETRY = 0 WHERE ID = $2"
+	delTorrentFile         = "DELETE FROM TT_TORRENT_FILE WHERE ID = $1"
 	setTorrentFileStatus   = "UPDATE TT_TORRENT_FILE SET READY = $1 WHERE ID = $2"
+	skipTorrentFile        = "UPDATE TT_TORRENT_FILE SET READY = $1, LAST_ERROR = $2 WHERE ID = $3"
 	setTorrentFileEntryId  = "UPDATE TT_TORRENT_FILE SET ENTRY_ID = $1 WHERE ID = $2"
+	setTorrentFileProgress = "UPDATE TT_TORRENT_FILE SET READY = $1, PROGRESS = $2 WHERE ID = $3"
+	setTorrentFileUpload   = "UPDATE TT_TORRENT_FILE SET UPLOAD_TOKEN = $1, UPLOAD_OFFSET = $2 WHERE ID = $3"
+	setTorrentFileError    = "UPDATE TT_TORRENT_FILE SET READY = $1, ATTEMPTS = $2, LAST_ERROR = $3, NEXT_RETRY = $4 WHERE ID = $5"
+
+	selectFileMedia = "SELECT DURATION, VIDEO_CODEC, AUDIO_CODEC, WIDTH, HEIGHT, AUDIO_LANGUAGES, BITRATE FROM TT_FILE_MEDIA WHERE FILE = $1"
+	insertFileMedia = "INSERT INTO TT_FILE_MEDIA(FILE, DURATION, VIDEO_CODEC, AUDIO_CODEC, WIDTH, HEIGHT, AUDIO_LANGUAGES, BITRATE) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) " +
+		"ON CONFLICT(FILE) DO UPDATE SET DURATION = EXCLUDED.DURATION, VIDEO_CODEC = EXCLUDED.VIDEO_CODEC, AUDIO_CODEC = EXCLUDED.AUDIO_CODEC, " +
+		"WIDTH = EXCLUDED.WIDTH, HEIGHT = EXCLUDED.HEIGHT, AUDIO_LANGUAGES = EXCLUDED.AUDIO_LANGUAGES, BITRATE = EXCLUDED.BITRATE"
+
+	insertVideoPart = "INSERT INTO TT_VIDEO_PART(FILE, PART, PARTS, SIZE, DURATION, SENT) VALUES ($1, $2, $3, $4, $5, $6) " +
+		"ON CONFLICT(FILE, PART) DO UPDATE SET PARTS = EXCLUDED.PARTS, SIZE = EXCLUDED.SIZE, DURATION = EXCLUDED.DURATION, SENT = EXCLUDED.SENT"
+
+	insertTgMessage        = "INSERT INTO TT_TG_MESSAGE(CHAT, FILE, KIND, PART, CAPTION, SENT) VALUES ($1, $2, $3, $4, $5, $6)"
+	selectFileMissingChats = "SELECT C.ID FROM TT_CHAT C WHERE NOT EXISTS (SELECT 1 FROM TT_TG_MESSAGE M WHERE M.CHAT = C.ID AND M.FILE = $1 AND M.KIND IN ($2, $3))"
 
 	selectConfig         = "SELECT VALUE FROM TT_CONFIG WHERE NAME = $1"
 	insertOrUpdateConfig = "INSERT INTO TT_CONFIG(NAME, VALUE) VALUES ($1, $2) ON CONFLICT(NAME) DO UPDATE SET VALUE = EXCLUDED.VALUE"
@@ -75,10 +120,11 @@ const (
 	confCrawlOffset = "CRAWL_OFFSET"
 	confTgOffset    = "TG_OFFSET"
 
-	FilePendingStatus    = 0
-	FileConvertingStatus = 1
-	FileReadyStatus      = 2
-	FileErrorStatus      = 255
+	FilePendingStatus     = 0
+	FileConvertingStatus  = 1
+	FileReadyStatus       = 2
+	FileDownloadingStatus = 3
+	FileErrorStatus       = 255
 
 	TorrentInvalidId = -1
 )
@@ -181,13 +227,13 @@ func (db *Database) DelAdmin(id int64) error {
 	return db.execNoResult(delAdmin, id)
 }
 
-func (db *Database) GetTorrent(torrent string) (int64, error) {
+func (db *Database) GetTorrent(hash, name string) (int64, error) {
 	var torrentId int64
 	var err error
 	torrentId = TorrentInvalidId
 	if err = db.checkConnection(); err == nil {
 		var rows *sql.Rows
-		rows, err = db.Connection.Query(selectTorrentId, torrent)
+		rows, err = db.Connection.Query(selectTorrentId, hash, name)
 		if err == nil && rows != nil {
 			defer rows.Close()
 			if rows.Next() {
@@ -198,6 +244,58 @@ func (db *Database) GetTorrent(torrent string) (int64, error) {
 	return torrentId, err
 }
 
+func (db *Database) GetTorrentName(id int64) (string, error) {
+	var name string
+	var err error
+	if err = db.checkConnection(); err == nil {
+		var rows *sql.Rows
+		rows, err = db.Connection.Query(selectTorrentName, id)
+		if err == nil && rows != nil {
+			defer rows.Close()
+			if rows.Next() {
+				err = rows.Scan(&name)
+			}
+		}
+	}
+	return name, err
+}
+
+func (db *Database) GetTorrentHash(id int64) (string, error) {
+	var hash string
+	var err error
+	if err = db.checkConnection(); err == nil {
+		var rows *sql.Rows
+		rows, err = db.Connection.Query(selectTorrentHash, id)
+		if err == nil && rows != nil {
+			defer rows.Close()
+			if rows.Next() {
+				err = rows.Scan(&hash)
+			}
+		}
+	}
+	return hash, err
+}
+
+func (db *Database) GetTorrentPlaylist(id int64) (string, error) {
+	var playlist string
+	var err error
+	if err = db.checkConnection(); err == nil {
+		var rows *sql.Rows
+		rows, err = db.Connection.Query(selectTorrentPlaylist, id)
+		if err == nil && rows != nil {
+			defer rows.Close()
+			if rows.Next() {
+				err = rows.Scan(&playlist)
+			}
+		}
+	}
+	return playlist, err
+}
+
+func (db *Database) SetTorrentPlaylist(id int64, playlist string) error {
+	return db.execNoResult(setTorrentPlaylist, playlist, id)
+}
+
 func (db *Database) GetTorrentOffset(id int64) (uint, error) {
 	var offset uint
 	var err error
@@ -214,33 +312,257 @@ func (db *Database) GetTorrentOffset(id int64) (uint, error) {
 	return offset, err
 }
 
-func (db *Database) AddTorrent(name string, offset uint, files []string) (int64, error) {
+func (db *Database) AddTorrent(name, hash string, source int64, offset uint, files []TorrentFile) (int64, error) {
 	var err error
 	var id int64
-	if err = db.execNoResult(insertOrUpdateTorrent, name, offset); err == nil {
-		if id, err = db.GetTorrent(name); err == nil {
-			for _, file := range files {
-				err = db.execNoResult(insertTorrentFile, id, file)
+	if id, err = db.GetTorrent(hash, name); err == nil {
+		if id == TorrentInvalidId {
+			if err = db.execNoResult(insertTorrent, name, hash, source, offset); err == nil {
+				id, err = db.GetTorrent(hash, name)
+			}
+			if err == nil {
+				err = db.AddTorrentFiles(id, files)
 			}
+		} else {
+			err = db.UpdateTorrent(id, name, hash, source, offset, files)
 		}
 	}
 	return id, err
 }
 
+func (db *Database) UpdateTorrent(id int64, name, hash string, source int64, offset uint, files []TorrentFile) error {
+	var err error
+	if err = db.execNoResult(updateTorrent, name, hash, source, offset, id); err == nil {
+		err = db.AddTorrentFiles(id, files)
+	}
+	return err
+}
+
+func (db *Database) GetTorrentsByName(name string, source int64, excludeHash string) ([]int64, error) {
+	return db.getIntArray(selectTorrentsByName, name, source, excludeHash)
+}
+
+func (db *Database) AddTorrentFiles(id int64, files []TorrentFile) error {
+	var err error
+	for _, file := range files {
+		if err = db.execNoResult(insertTorrentFile, id, file.Name, file.Length, file.Hash); err != nil {
+			break
+		}
+	}
+	return err
+}
+
+func (db *Database) ResetTorrentFile(id int64) error {
+	return db.execNoResult(resetTorrentFile, FilePendingStatus, id)
+}
+
+func (db *Database) DelTorrentFile(id int64) error {
+	return db.execNoResult(delTorrentFile, id)
+}
+
+func (db *Database) SetTorrentMagnet(id int64, magnet string) error {
+	return db.execNoResult(setTorrentMagnet, magnet, id)
+}
+
+func (db *Database) SetTorrentName(id int64, name string) error {
+	return db.execNoResult(setTorrentName, name, id)
+}
+
+type MagnetTorrent struct {
+	Id     int64
+	Name   string
+	Magnet string
+}
+
+func (db *Database) GetUnresolvedMagnets() ([]MagnetTorrent, error) {
+	var err error
+	var torrents []MagnetTorrent
+	err = db.checkConnection()
+	if err == nil {
+		var rows *sql.Rows
+		rows, err = db.Connection.Query(selectTorrentMagnets)
+		if err == nil && rows != nil {
+			defer rows.Close()
+			for rows.Next() {
+				torrent := MagnetTorrent{}
+				if err = rows.Scan(&torrent.Id, &torrent.Name, &torrent.Magnet); err == nil {
+					torrents = append(torrents, torrent)
+				} else {
+					break
+				}
+			}
+		}
+	}
+	return torrents, err
+}
+
+func (db *Database) GetSource(name string) (int64, error) {
+	var err error
+	var ids []int64
+	id := int64(TorrentInvalidId)
+	if ids, err = db.getIntArray(selectSourceId, name); err == nil && len(ids) > 0 {
+		id = ids[0]
+	}
+	return id, err
+}
+
+func (db *Database) GetSourcesCount() (int64, error) {
+	var err error
+	var count int64
+	var tmp []int64
+	if tmp, err = db.getIntArray(selectSourcesCount); err == nil && len(tmp) > 0 {
+		count = tmp[0]
+	}
+	return count, err
+}
+
+func (db *Database) AddSource(name string, offset uint) (int64, error) {
+	var err error
+	var id int64
+	if err = db.execNoResult(insertSource, name, offset); err == nil {
+		id, err = db.GetSource(name)
+	}
+	return id, err
+}
+
+func (db *Database) GetSourceOffset(id int64) (uint, error) {
+	var err error
+	var offset uint
+	var tmp []int64
+	if tmp, err = db.getIntArray(selectSourceOffset, id); err == nil && len(tmp) > 0 {
+		offset = uint(tmp[0])
+	}
+	return offset, err
+}
+
+func (db *Database) UpdateSourceOffset(id int64, offset uint) error {
+	return db.execNoResult(setSourceOffset, offset, id)
+}
+
+func (db *Database) GetFeedItemExist(source int64, guid string) (bool, error) {
+	return db.getNotEmpty(existFeedItem, source, guid)
+}
+
+func (db *Database) AddFeedItem(source int64, guid string) error {
+	return db.execNoResult(insertFeedItem, source, guid)
+}
+
+type TorrentInfo struct {
+	Id     int64
+	Name   string
+	Hash   string
+	Source string
+	Offset uint
+	Magnet string
+	Files  int64
+	Ready  int64
+}
+
+func (db *Database) getTorrentsInfoQuery(query string, args ...interface{}) ([]TorrentInfo, error) {
+	var err error
+	var torrents []TorrentInfo
+	err = db.checkConnection()
+	if err == nil {
+		var rows *sql.Rows
+		rows, err = db.Connection.Query(query, args...)
+		if err == nil && rows != nil {
+			defer rows.Close()
+			for rows.Next() {
+				torrent := TorrentInfo{}
+				if err = rows.Scan(&torrent.Id, &torrent.Name, &torrent.Hash, &torrent.Source, &torrent.Offset,
+					&torrent.Magnet, &torrent.Files, &torrent.Ready); err == nil {
+					torrents = append(torrents, torrent)
+				} else {
+					break
+				}
+			}
+		}
+	}
+	return torrents, err
+}
+
+func (db *Database) GetTorrents(limit, offset uint) ([]TorrentInfo, error) {
+	return db.getTorrentsInfoQuery(selectTorrents, FileReadyStatus, limit, offset)
+}
+
+func (db *Database) GetTorrentInfo(id int64) (TorrentInfo, error) {
+	var err error
+	torrent := TorrentInfo{
+		Id: TorrentInvalidId,
+	}
+	var torrents []TorrentInfo
+	if torrents, err = db.getTorrentsInfoQuery(selectTorrentInfo, FileReadyStatus, id); err == nil && len(torrents) > 0 {
+		torrent = torrents[0]
+	}
+	return torrent, err
+}
+
+type SourceState struct {
+	Name     string
+	Offset   uint
+	Torrents int64
+	Pending  int64
+}
+
+func (s *SourceState) String() string {
+	if s == nil {
+		return "nil"
+	}
+	return fmt.Sprintf("Source: %s;\tNext index: %d;\tTorrents: %d;\tPending files: %d", s.Name, s.Offset, s.Torrents, s.Pending)
+}
+
+func (db *Database) GetSourcesState() ([]SourceState, error) {
+	var err error
+	var states []SourceState
+	err = db.checkConnection()
+	if err == nil {
+		var rows *sql.Rows
+		rows, err = db.Connection.Query(selectSourcesState, FileReadyStatus)
+		if err == nil && rows != nil {
+			defer rows.Close()
+			for rows.Next() {
+				state := SourceState{}
+				if err = rows.Scan(&state.Name, &state.Offset, &state.Torrents, &state.Pending); err == nil {
+					states = append(states, state)
+				} else {
+					break
+				}
+			}
+		}
+	}
+	return states, err
+}
+
 type TorrentFile struct {
-	Id      int64
-	Torrent int64
-	Name    string
-	Status  uint8
-	EntryId string
-	Index   int64
+	Id          int64
+	Torrent     int64
+	Name        string
+	Status      uint8
+	EntryId     string
+	Progress    float64
+	Length      uint64
+	Hash        string
+	Attempts    uint
+	LastError   string
+	NextRetry   int64
+	UploadToken string
+	UploadedLen int64
+	TorrentHash string
+	Source      int64
+	Index       int64
 }
 
 func (tr *TorrentFile) String() string {
 	if tr == nil {
 		return "nil"
 	}
-	return fmt.Sprintf("Id: %d;\tName: %s;\tStatus: %d", tr.Id, tr.Name, tr.Status)
+	if tr.Status == FileErrorStatus {
+		return fmt.Sprintf("Id: %d;\tHash: %s;\tName: %s;\tStatus: %d;\tAttempts: %d;\tError: %s", tr.Id, tr.TorrentHash, tr.Name, tr.Status, tr.Attempts, tr.LastError)
+	}
+	if tr.Status == FileDownloadingStatus {
+		return fmt.Sprintf("Id: %d;\tHash: %s;\tName: %s;\tStatus: %d;\tProgress: %.1f%%", tr.Id, tr.TorrentHash, tr.Name, tr.Status, tr.Progress*100)
+	}
+	return fmt.Sprintf("Id: %d;\tHash: %s;\tName: %s;\tStatus: %d", tr.Id, tr.TorrentHash, tr.Name, tr.Status)
 }
 
 func (db *Database) getTorrentFilesQuery(query string, args ...interface{}) ([]TorrentFile, error) {
@@ -254,7 +576,7 @@ func (db *Database) getTorrentFilesQuery(query string, args ...interface{}) ([]T
 			defer rows.Close()
 			for rows.Next() {
 				file := TorrentFile{}
-				if err = rows.Scan(&file.Id, &file.Torrent, &file.Name, &file.EntryId, &file.Status, &file.Index); err == nil {
+				if err = rows.Scan(&file.Id, &file.Torrent, &file.Name, &file.EntryId, &file.Status, &file.Progress, &file.Length, &file.Hash, &file.Attempts, &file.LastError, &file.NextRetry, &file.UploadToken, &file.UploadedLen, &file.TorrentHash, &file.Source, &file.Index); err == nil {
 					files = append(files, file)
 				} else {
 					files = []TorrentFile{}
@@ -300,6 +622,26 @@ func (db *Database) SetTorrentFileStatus(id int64, status uint8) error {
 	return db.execNoResult(setTorrentFileStatus, status, id)
 }
 
+func (db *Database) SkipTorrentFile(id int64, reason string) error {
+	return db.execNoResult(skipTorrentFile, FileReadyStatus, reason, id)
+}
+
+func (db *Database) SetTorrentFileProgress(id int64, status uint8, progress float64) error {
+	return db.execNoResult(setTorrentFileProgress, status, progress, id)
+}
+
+func (db *Database) SetTorrentFileUpload(id int64, token string, offset int64) error {
+	return db.execNoResult(setTorrentFileUpload, token, offset, id)
+}
+
+func (db *Database) SetTorrentFileError(id int64, attempts uint, lastError string, nextRetry time.Time) error {
+	return db.execNoResult(setTorrentFileError, FileErrorStatus, attempts, lastError, nextRetry.Unix(), id)
+}
+
+func (db *Database) RetryTorrentFile(id int64) error {
+	return db.execNoResult(retryTorrentFile, FilePendingStatus, id)
+}
+
 func (db *Database) SetTorrentFileEntryId(id int64, entryId string) error {
 	return db.execNoResult(setTorrentFileEntryId, entryId, id)
 }
@@ -385,11 +727,47 @@ func (db *Database) AddTorrentMeta(id int64, meta map[string]string) error {
 	return err
 }
 
+func (db *Database) GetFileMedia(id int64) (MediaInfo, error) {
+	var err error
+	var media MediaInfo
+	if err = db.checkConnection(); err == nil {
+		var rows *sql.Rows
+		rows, err = db.Connection.Query(selectFileMedia, id)
+		if err == nil && rows != nil {
+			defer rows.Close()
+			if rows.Next() {
+				err = rows.Scan(&media.Duration, &media.VideoCodec, &media.AudioCodec, &media.Width, &media.Height,
+					&media.AudioLanguages, &media.Bitrate)
+			}
+		}
+	}
+	return media, err
+}
+
+func (db *Database) SetFileMedia(id int64, media MediaInfo) error {
+	return db.execNoResult(insertFileMedia, id, media.Duration, media.VideoCodec, media.AudioCodec,
+		media.Width, media.Height, media.AudioLanguages, media.Bitrate)
+}
+
+func (db *Database) AddVideoPart(id int64, part, parts int, size int64, duration float64) error {
+	return db.execNoResult(insertVideoPart, id, part, parts, size, duration, time.Now().Unix())
+}
+
+func (db *Database) AddTgMessage(chat, file int64, kind string, part int, caption string) error {
+	return db.execNoResult(insertTgMessage, chat, file, kind, part, caption, time.Now().Unix())
+}
+
+func (db *Database) GetFileMissingChats(file int64) ([]int64, error) {
+	return db.getIntArray(selectFileMissingChats, file, tgKindVideo, tgKindLink)
+}
+
 func (db *Database) Connect() error {
 	var err error
 	db.Connection, err = sql.Open(DBDriver, db.ConnectionString)
 	if err == nil {
-		err = db.checkConnection()
+		if err = db.checkConnection(); err == nil {
+			err = db.migrate()
+		}
 	}
 	return err
 }
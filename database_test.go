@@ -0,0 +1,171 @@
+/*
+ * BSD-3-Clause
+ * Copyright 2020 sot (PR_713, C_rho_272)
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ * 1. Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ * this list of conditions and the following disclaimer in the documentation and/or
+ * other materials provided with the distribution.
+ * 3. Neither the name of the copyright holder nor the names of its contributors
+ * may be used to endorse or promote products derived from this software without
+ * specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+ * IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+ * BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+ * OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+ * WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY
+ * OF SUCH DAMAGE.
+ */
+
+package TtKVC
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func tableColumns(t *testing.T, conn *sql.DB) map[string][]string {
+	res := make(map[string][]string)
+	rows, err := conn.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name LIKE 'tt_%'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		tables = append(tables, name)
+	}
+	_ = rows.Close()
+	for _, table := range tables {
+		var columns []string
+		if rows, err = conn.Query("SELECT name FROM pragma_table_info(?)", table); err != nil {
+			t.Fatal(err)
+		}
+		for rows.Next() {
+			var name string
+			if err = rows.Scan(&name); err != nil {
+				t.Fatal(err)
+			}
+			columns = append(columns, name)
+		}
+		_ = rows.Close()
+		res[table] = columns
+	}
+	return res
+}
+
+func copyExampleDB(t *testing.T, dir string) string {
+	data, err := ioutil.ReadFile("conf/example.sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "example.sqlite")
+	if err = ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestMigrateBaseline(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ttkvc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	schema, err := ioutil.ReadFile("testdata/baseline.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "baseline.sqlite")
+	conn, err := sql.Open(DBDriver, path+"?_foreign_keys=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = conn.Exec(string(schema)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = conn.Exec(`INSERT INTO tt_torrent(id, name, offset) VALUES (1, 'test', 10);
+		INSERT INTO tt_torrent_file(id, torrent, name, ready, entry_id) VALUES (1, 1, 'test.mkv', 2, '0_abc');
+		INSERT INTO tt_torrent_meta(torrent, name, value) VALUES (1, 'title', 'Test')`); err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.Close()
+
+	db := Database{ConnectionString: path + "?_foreign_keys=1"}
+	if err = db.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var version int
+	if err = db.Connection.QueryRow(getSchemaVersion).Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	if version != len(migrations) {
+		t.Error("unexpected schema version", version)
+	}
+	files, err := db.GetTorrentFiles(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].EntryId != "0_abc" {
+		t.Error("torrent files lost after migration", files)
+	}
+	meta, err := db.GetTorrentMeta(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta["title"] != "Test" {
+		t.Error("torrent meta lost after migration", meta)
+	}
+	source, err := db.AddSource("test", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.AddTorrent("test", "", source, 0, nil); err != nil {
+		t.Error("torrent name must not be unique", err)
+	}
+
+	examplePath := copyExampleDB(t, dir)
+	example, err := sql.Open(DBDriver, examplePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer example.Close()
+	if expected, actual := tableColumns(t, example), tableColumns(t, db.Connection); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("migrated schema differs from example\nexpected: %v\nactual:   %v", expected, actual)
+	}
+}
+
+func TestMigrateCurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ttkvc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db := Database{ConnectionString: copyExampleDB(t, dir)}
+	if err = db.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var version int
+	if err = db.Connection.QueryRow(getSchemaVersion).Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	if version != len(migrations) {
+		t.Error("example database is not at latest schema version", version)
+	}
+}
@@ -0,0 +1,328 @@
+/*
+ * BSD-3-Clause
+ * Copyright 2020 sot (PR_713, C_rho_272)
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ * 1. Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ * this list of conditions and the following disclaimer in the documentation and/or
+ * other materials provided with the distribution.
+ * 3. Neither the name of the copyright holder nor the names of its contributors
+ * may be used to endorse or promote products derived from this software without
+ * specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+ * IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+ * BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+ * OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+ * WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY
+ * OF SUCH DAMAGE.
+ */
+
+package TtKVC
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"sync/atomic"
+)
+
+const (
+	delugeAPIContext       = "/json"
+	delugeNotAuthenticated = 1
+)
+
+type delugeClient struct {
+	url       string
+	password  string
+	client    *http.Client
+	requestId uint64
+}
+
+type delugeRequest struct {
+	Method string        `json:"method"`
+	Params []interface{} `json:"params"`
+	Id     uint64        `json:"id"`
+}
+
+type delugeError struct {
+	Message string `json:"message"`
+	Code    int    `json:"code"`
+}
+
+func (e *delugeError) Error() string {
+	return fmt.Sprintf("deluge: %s (%d)", e.Message, e.Code)
+}
+
+type delugeResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *delugeError    `json:"error"`
+	Id     uint64          `json:"id"`
+}
+
+type delugeTorrent struct {
+	Name     string  `json:"name"`
+	Hash     string  `json:"hash"`
+	Progress float64 `json:"progress"`
+}
+
+func (t delugeTorrent) convert() ClientTorrent {
+	return ClientTorrent{
+		Id:       t.Hash,
+		Name:     t.Name,
+		Hash:     t.Hash,
+		Progress: t.Progress / 100,
+	}
+}
+
+type delugeTracker struct {
+	URL  string `json:"url"`
+	Tier int    `json:"tier"`
+}
+
+type delugeFile struct {
+	Index int    `json:"index"`
+	Path  string `json:"path"`
+	Size  int64  `json:"size"`
+}
+
+func newDelugeClient(conf TorrentClientConfig) (TorrentClient, error) {
+	var err error
+	var res *delugeClient
+	var jar *cookiejar.Jar
+	if jar, err = cookiejar.New(nil); err == nil {
+		res = &delugeClient{
+			url:      conf.baseURL() + delugeAPIContext,
+			password: conf.Password,
+			client:   &http.Client{Jar: jar},
+		}
+		err = res.auth()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (d *delugeClient) auth() error {
+	var err error
+	var ok bool
+	if err = d.send("auth.login", []interface{}{d.password}, &ok); err == nil {
+		if !ok {
+			err = errors.New("deluge: authorization failed")
+		} else if err = d.send("web.connected", []interface{}{}, &ok); err == nil && !ok {
+			var hosts [][]interface{}
+			if err = d.send("web.get_hosts", []interface{}{}, &hosts); err == nil {
+				if len(hosts) == 0 || len(hosts[0]) == 0 {
+					err = errors.New("deluge: no daemon hosts available")
+				} else {
+					err = d.send("web.connect", []interface{}{hosts[0][0]}, nil)
+				}
+			}
+		}
+	}
+	return err
+}
+
+func (d *delugeClient) send(method string, params []interface{}, result interface{}) error {
+	var err error
+	var data []byte
+	req := delugeRequest{
+		Method: method,
+		Params: params,
+		Id:     atomic.AddUint64(&d.requestId, 1),
+	}
+	if data, err = json.Marshal(req); err == nil {
+		if resp, httpErr := d.client.Post(d.url, jsonMime, bytes.NewReader(data)); checkResponse(resp, httpErr) {
+			defer resp.Body.Close()
+			if data, err = ioutil.ReadAll(resp.Body); err == nil {
+				res := delugeResponse{}
+				if err = json.Unmarshal(data, &res); err == nil {
+					if res.Error != nil {
+						err = res.Error
+					} else if result != nil && len(res.Result) > 0 {
+						err = json.Unmarshal(res.Result, result)
+					}
+				}
+			}
+		} else {
+			err = responseError(resp, httpErr)
+		}
+	}
+	return err
+}
+
+func (d *delugeClient) call(method string, params []interface{}, result interface{}) error {
+	err := d.send(method, params, result)
+	if dErr, ok := err.(*delugeError); ok && dErr.Code == delugeNotAuthenticated {
+		if err = d.auth(); err == nil {
+			err = d.send(method, params, result)
+		}
+	}
+	return err
+}
+
+func (d *delugeClient) GetTorrents() ([]ClientTorrent, error) {
+	var err error
+	var res []ClientTorrent
+	torrents := make(map[string]delugeTorrent)
+	if err = d.call("core.get_torrents_status", []interface{}{
+		map[string]interface{}{},
+		[]string{"name", "hash", "progress"},
+	}, &torrents); err == nil {
+		res = make([]ClientTorrent, 0, len(torrents))
+		for hash, torrent := range torrents {
+			if isEmpty(torrent.Hash) {
+				torrent.Hash = hash
+			}
+			res = append(res, torrent.convert())
+		}
+	}
+	return res, err
+}
+
+func (d *delugeClient) RemoveTorrents(ids []string) error {
+	var err error
+	for _, id := range ids {
+		if err = d.call("core.remove_torrent", []interface{}{id, false}, nil); err != nil {
+			break
+		}
+	}
+	return err
+}
+
+func (d *delugeClient) getTorrent(id string) (delugeTorrent, error) {
+	res := delugeTorrent{}
+	err := d.call("core.get_torrent_status", []interface{}{id, []string{"name", "hash", "progress"}}, &res)
+	if err == nil && isEmpty(res.Hash) {
+		err = errors.New("deluge: torrent " + id + " not found")
+	}
+	return res, err
+}
+
+func (d *delugeClient) AddTorrent(metaInfo []byte, path string) (ClientTorrent, error) {
+	var err error
+	var res ClientTorrent
+	var hash, addedHash string
+	if hash, err = infoHash(metaInfo); err == nil {
+		if err = d.call("core.add_torrent_file", []interface{}{
+			hash + ".torrent",
+			base64.StdEncoding.EncodeToString(metaInfo),
+			map[string]interface{}{
+				"download_location": path,
+				"add_paused":        false,
+			},
+		}, &addedHash); err == nil {
+			if isEmpty(addedHash) {
+				addedHash = hash
+			}
+			var torrent delugeTorrent
+			if torrent, err = d.getTorrent(addedHash); err == nil {
+				res = torrent.convert()
+			}
+		}
+	}
+	return res, err
+}
+
+func (d *delugeClient) AddMagnet(uri string, path string) (ClientTorrent, error) {
+	var err error
+	var res ClientTorrent
+	var magnet *Magnet
+	var addedHash string
+	if magnet, err = ParseMagnet(uri); err == nil {
+		if err = d.call("core.add_torrent_magnet", []interface{}{
+			uri,
+			map[string]interface{}{
+				"download_location": path,
+				"add_paused":        false,
+			},
+		}, &addedHash); err == nil {
+			if isEmpty(addedHash) {
+				addedHash = magnet.InfoHash
+			}
+			var torrent delugeTorrent
+			if torrent, err = d.getTorrent(addedHash); err == nil {
+				res = torrent.convert()
+			}
+		}
+	}
+	return res, err
+}
+
+func (d *delugeClient) AddTrackers(ids []string, trackers []string) error {
+	var err error
+	for _, id := range ids {
+		status := struct {
+			Trackers []delugeTracker `json:"trackers"`
+		}{}
+		if err = d.call("core.get_torrent_status", []interface{}{id, []string{"trackers"}}, &status); err != nil {
+			break
+		}
+		tier := 0
+		existing := make(map[string]bool, len(status.Trackers))
+		for _, t := range status.Trackers {
+			existing[t.URL] = true
+			if t.Tier >= tier {
+				tier = t.Tier + 1
+			}
+		}
+		for _, t := range trackers {
+			if !existing[t] {
+				status.Trackers = append(status.Trackers, delugeTracker{URL: t, Tier: tier})
+				tier++
+			}
+		}
+		if err = d.call("core.set_torrent_trackers", []interface{}{id, status.Trackers}, nil); err != nil {
+			break
+		}
+	}
+	return err
+}
+
+func (d *delugeClient) GetProgress(id string) (float64, error) {
+	var res float64
+	torrent, err := d.getTorrent(id)
+	if err == nil {
+		res = torrent.Progress / 100
+	}
+	return res, err
+}
+
+func (d *delugeClient) GetFiles(id string) ([]ClientFile, error) {
+	var err error
+	var res []ClientFile
+	status := struct {
+		Files        []delugeFile `json:"files"`
+		FileProgress []float64    `json:"file_progress"`
+	}{}
+	if err = d.call("core.get_torrent_status", []interface{}{id, []string{"files", "file_progress"}}, &status); err == nil {
+		if len(status.Files) == 0 {
+			err = errors.New("deluge: torrent " + id + " not found")
+		} else {
+			res = make([]ClientFile, 0, len(status.Files))
+			for i, file := range status.Files {
+				cf := ClientFile{
+					Name:   file.Path,
+					Length: file.Size,
+				}
+				if i < len(status.FileProgress) {
+					cf.Progress = status.FileProgress[i]
+				}
+				res = append(res, cf)
+			}
+		}
+	}
+	return res, err
+}
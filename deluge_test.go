@@ -0,0 +1,192 @@
+/*
+ * BSD-3-Clause
+ * Copyright 2020 sot (PR_713, C_rho_272)
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ * 1. Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ * this list of conditions and the following disclaimer in the documentation and/or
+ * other materials provided with the distribution.
+ * 3. Neither the name of the copyright holder nor the names of its contributors
+ * may be used to endorse or promote products derived from this software without
+ * specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+ * IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+ * BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+ * OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+ * WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY
+ * OF SUCH DAMAGE.
+ */
+
+package TtKVC
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+type fakeDeluge struct {
+	mutex     sync.Mutex
+	session   string
+	logins    int
+	connected bool
+	metaInfo  []byte
+	path      string
+	torrent   delugeTorrent
+}
+
+func (f *fakeDeluge) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	req := struct {
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+		Id     uint64            `json:"id"`
+	}{}
+	if r.URL.Path != delugeAPIContext || json.NewDecoder(r.Body).Decode(&req) != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var result interface{}
+	var rpcErr *delugeError
+	cookie, cookieErr := r.Cookie("_session_id")
+	authorized := cookieErr == nil && cookie.Value == f.session
+	switch {
+	case req.Method == "auth.login":
+		var password string
+		_ = json.Unmarshal(req.Params[0], &password)
+		if result = password == "secret"; password == "secret" {
+			f.logins++
+			f.session = "session" + strconv.Itoa(f.logins)
+			http.SetCookie(w, &http.Cookie{Name: "_session_id", Value: f.session, Path: "/"})
+		}
+	case !authorized:
+		rpcErr = &delugeError{Message: "Not authenticated", Code: delugeNotAuthenticated}
+	case req.Method == "web.connected":
+		result = f.connected
+	case req.Method == "web.get_hosts":
+		result = [][]interface{}{{"daemon", "127.0.0.1", 58846, "Online"}}
+	case req.Method == "web.connect":
+		var host string
+		_ = json.Unmarshal(req.Params[0], &host)
+		f.connected = host == "daemon"
+	case !f.connected:
+		rpcErr = &delugeError{Message: "Not connected", Code: 2}
+	case req.Method == "core.add_torrent_file":
+		var metaInfo string
+		var options map[string]interface{}
+		_ = json.Unmarshal(req.Params[1], &metaInfo)
+		_ = json.Unmarshal(req.Params[2], &options)
+		f.metaInfo, _ = base64.StdEncoding.DecodeString(metaInfo)
+		f.path, _ = options["download_location"].(string)
+		result = f.torrent.Hash
+	case req.Method == "core.get_torrent_status":
+		var id string
+		_ = json.Unmarshal(req.Params[0], &id)
+		if id == f.torrent.Hash {
+			result = map[string]interface{}{
+				"name":          f.torrent.Name,
+				"hash":          f.torrent.Hash,
+				"progress":      f.torrent.Progress,
+				"files":         []delugeFile{{Index: 0, Path: "test.mkv", Size: 1024}},
+				"file_progress": []float64{f.torrent.Progress / 100},
+			}
+		} else {
+			result = map[string]interface{}{}
+		}
+	case req.Method == "core.get_torrents_status":
+		result = map[string]delugeTorrent{f.torrent.Hash: f.torrent}
+	default:
+		rpcErr = &delugeError{Message: "Unknown method", Code: 2}
+	}
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"result": result,
+		"error":  rpcErr,
+		"id":     req.Id,
+	})
+}
+
+func TestDelugeClient(t *testing.T) {
+	metaInfo, hash := testMetaInfo(t)
+	fake := &fakeDeluge{torrent: delugeTorrent{Name: "test.mkv", Hash: hash, Progress: 50}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	client, err := NewTorrentClient(testClientConfig(t, server, ClientDeluge))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fake.connected {
+		t.Error("expected connection to daemon host")
+	}
+	added, err := client.AddTorrent(metaInfo, "/download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added.Id != hash || added.Progress != 0.5 {
+		t.Error("unexpected added torrent", added)
+	}
+	if !bytes.Equal(fake.metaInfo, metaInfo) || fake.path != "/download" {
+		t.Error("unexpected add payload", fake.path)
+	}
+	torrents, err := client.GetTorrents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(torrents) != 1 || torrents[0].Hash != hash || torrents[0].Name != "test.mkv" {
+		t.Error("unexpected torrents", torrents)
+	}
+	files, err := client.GetFiles(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Name != "test.mkv" || files[0].Progress != 0.5 {
+		t.Error("unexpected files", files)
+	}
+}
+
+func TestDelugeClientSessionExpiry(t *testing.T) {
+	_, hash := testMetaInfo(t)
+	fake := &fakeDeluge{torrent: delugeTorrent{Name: "test.mkv", Hash: hash, Progress: 100}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	client, err := NewTorrentClient(testClientConfig(t, server, ClientDeluge))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.mutex.Lock()
+	fake.session = "expired"
+	fake.connected = false
+	fake.mutex.Unlock()
+	progress, err := client.GetProgress(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress != 1 {
+		t.Error("unexpected progress", progress)
+	}
+	if fake.logins != 2 || !fake.connected {
+		t.Error("expected relogin and reconnect after session expiry, logins:", fake.logins)
+	}
+}
+
+func TestDelugeClientAuthFailed(t *testing.T) {
+	server := httptest.NewServer(&fakeDeluge{})
+	defer server.Close()
+	conf := testClientConfig(t, server, ClientDeluge)
+	conf.Password = "wrong"
+	if client, err := NewTorrentClient(conf); err == nil || client != nil {
+		t.Error("expected authorization error, got", client, err)
+	}
+}
@@ -0,0 +1,226 @@
+/*
+ * BSD-3-Clause
+ * Copyright 2020 sot (PR_713, C_rho_272)
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ * 1. Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ * this list of conditions and the following disclaimer in the documentation and/or
+ * other materials provided with the distribution.
+ * 3. Neither the name of the copyright holder nor the names of its contributors
+ * may be used to endorse or promote products derived from this software without
+ * specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+ * IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+ * BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+ * OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+ * WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY
+ * OF SUCH DAMAGE.
+ */
+
+package TtKVC
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	torrentMime  = "application/x-bittorrent"
+	torrentExt   = ".torrent"
+	magnetPrefix = "magnet:"
+	rssRoot      = "rss"
+	atomRoot     = "feed"
+)
+
+type FeedItem struct {
+	GUID       string
+	Title      string
+	Link       string
+	TorrentURL string
+}
+
+type rssFeed struct {
+	Channel struct {
+		Items []struct {
+			Title      string `xml:"title"`
+			Link       string `xml:"link"`
+			GUID       string `xml:"guid"`
+			Enclosures []struct {
+				URL  string `xml:"url,attr"`
+				Type string `xml:"type,attr"`
+			} `xml:"enclosure"`
+		} `xml:"item"`
+	} `xml:"channel"`
+}
+
+type atomFeed struct {
+	Entries []struct {
+		Title string `xml:"title"`
+		ID    string `xml:"id"`
+		Links []struct {
+			Href string `xml:"href,attr"`
+			Rel  string `xml:"rel,attr"`
+			Type string `xml:"type,attr"`
+		} `xml:"link"`
+	} `xml:"entry"`
+}
+
+func isTorrentLink(link, mime string) bool {
+	return mime == torrentMime ||
+		strings.HasPrefix(link, magnetPrefix) ||
+		strings.HasSuffix(strings.ToLower(strings.SplitN(link, "?", 2)[0]), torrentExt)
+}
+
+func GetFeed(feedUrl string, limiter *RateLimiter) ([]FeedItem, error) {
+	var err error
+	var items []FeedItem
+	limiter.Wait(feedUrl)
+	if resp, httpErr := http.Get(feedUrl); checkResponse(resp, httpErr) {
+		defer resp.Body.Close()
+		var data []byte
+		if data, err = ioutil.ReadAll(resp.Body); err == nil {
+			if items, err = ParseFeed(data); err == nil {
+				var base *url.URL
+				if base, err = url.Parse(feedUrl); err == nil {
+					for i := range items {
+						items[i].TorrentURL = resolveURL(base, items[i].TorrentURL)
+						items[i].Link = resolveURL(base, items[i].Link)
+					}
+				}
+			}
+		}
+	} else {
+		err = responseError(resp, httpErr)
+	}
+	return items, err
+}
+
+func resolveURL(base *url.URL, link string) string {
+	if isEmpty(link) || strings.HasPrefix(link, magnetPrefix) {
+		return link
+	}
+	if ref, err := url.Parse(link); err == nil {
+		return base.ResolveReference(ref).String()
+	}
+	return link
+}
+
+func ParseFeed(data []byte) ([]FeedItem, error) {
+	var err error
+	var items []FeedItem
+	root := struct {
+		XMLName xml.Name
+	}{}
+	if err = xml.Unmarshal(data, &root); err == nil {
+		switch root.XMLName.Local {
+		case rssRoot:
+			items, err = parseRSS(data)
+		case atomRoot:
+			items, err = parseAtom(data)
+		default:
+			err = errors.New("unsupported feed format " + root.XMLName.Local)
+		}
+	}
+	if err == nil {
+		items = uniqueFeedItems(items)
+	}
+	return items, err
+}
+
+func uniqueFeedItems(items []FeedItem) []FeedItem {
+	seen := make(map[string]bool, len(items))
+	unique := items[:0]
+	for _, item := range items {
+		if !seen[item.GUID] {
+			seen[item.GUID] = true
+			unique = append(unique, item)
+		}
+	}
+	return unique
+}
+
+func decodeXML(data []byte, v interface{}) error {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+	return decoder.Decode(v)
+}
+
+func parseRSS(data []byte) ([]FeedItem, error) {
+	var err error
+	var items []FeedItem
+	feed := rssFeed{}
+	if err = decodeXML(data, &feed); err == nil {
+		items = make([]FeedItem, 0, len(feed.Channel.Items))
+		for _, rssItem := range feed.Channel.Items {
+			item := FeedItem{
+				GUID:  strings.TrimSpace(rssItem.GUID),
+				Title: strings.TrimSpace(rssItem.Title),
+				Link:  strings.TrimSpace(rssItem.Link),
+			}
+			for _, enclosure := range rssItem.Enclosures {
+				if isTorrentLink(enclosure.URL, enclosure.Type) {
+					item.TorrentURL = strings.TrimSpace(enclosure.URL)
+					break
+				}
+			}
+			if isEmpty(item.TorrentURL) && isTorrentLink(item.Link, "") {
+				item.TorrentURL = item.Link
+			}
+			if isEmpty(item.GUID) {
+				item.GUID = item.Link
+			}
+			if !isEmpty(item.TorrentURL) {
+				if isEmpty(item.GUID) {
+					item.GUID = item.TorrentURL
+				}
+				items = append(items, item)
+			}
+		}
+	}
+	return items, err
+}
+
+func parseAtom(data []byte) ([]FeedItem, error) {
+	var err error
+	var items []FeedItem
+	feed := atomFeed{}
+	if err = decodeXML(data, &feed); err == nil {
+		items = make([]FeedItem, 0, len(feed.Entries))
+		for _, entry := range feed.Entries {
+			item := FeedItem{
+				GUID:  strings.TrimSpace(entry.ID),
+				Title: strings.TrimSpace(entry.Title),
+			}
+			for _, link := range entry.Links {
+				href := strings.TrimSpace(link.Href)
+				if isEmpty(item.TorrentURL) && isTorrentLink(href, link.Type) {
+					item.TorrentURL = href
+				} else if isEmpty(item.Link) && (isEmpty(link.Rel) || link.Rel == "alternate") {
+					item.Link = href
+				}
+			}
+			if isEmpty(item.GUID) {
+				item.GUID = item.Link
+			}
+			if !isEmpty(item.TorrentURL) {
+				if isEmpty(item.GUID) {
+					item.GUID = item.TorrentURL
+				}
+				items = append(items, item)
+			}
+		}
+	}
+	return items, err
+}
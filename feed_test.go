@@ -0,0 +1,131 @@
+/*
+ * BSD-3-Clause
+ * Copyright 2020 sot (PR_713, C_rho_272)
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ * 1. Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ * this list of conditions and the following disclaimer in the documentation and/or
+ * other materials provided with the distribution.
+ * 3. Neither the name of the copyright holder nor the names of its contributors
+ * may be used to endorse or promote products derived from this software without
+ * specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+ * IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+ * BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+ * OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+ * WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY
+ * OF SUCH DAMAGE.
+ */
+
+package TtKVC
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testMagnet = "magnet:?xt=urn:btih:c12fe1c06bba254a9dc9f519b335aa7c1367a88a"
+
+func TestParseFeed(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string
+		items []FeedItem
+	}{
+		{
+			name: "rss",
+			file: "feed.rss.xml",
+			items: []FeedItem{
+				{GUID: "item-1", Title: "Show S01E01", Link: "/torrent/1", TorrentURL: "/download/1"},
+				{GUID: testMagnet + "&dn=Show+S01E02", Title: "Show S01E02", Link: testMagnet + "&dn=Show+S01E02", TorrentURL: testMagnet + "&dn=Show+S01E02"},
+			},
+		},
+		{
+			name: "atom",
+			file: "feed.atom.xml",
+			items: []FeedItem{
+				{GUID: "urn:tracker:2", Title: "Movie", Link: "/torrent/2", TorrentURL: "/download/2"},
+				{GUID: testMagnet, Title: "Magnet only", TorrentURL: testMagnet},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := ioutil.ReadFile(filepath.Join("testdata", test.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			items, err := ParseFeed(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(items, test.items) {
+				t.Errorf("unexpected items\n got: %+v\nwant: %+v", items, test.items)
+			}
+		})
+	}
+}
+
+func TestParseFeedUnsupported(t *testing.T) {
+	if _, err := ParseFeed([]byte(`<html><body></body></html>`)); err == nil {
+		t.Error("expected error for unsupported feed")
+	}
+	if _, err := ParseFeed([]byte(`not xml`)); err == nil {
+		t.Error("expected error for invalid feed")
+	}
+}
+
+func TestGetFeed(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "feed.atom.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(data)
+	}))
+	defer server.Close()
+	items, err := GetFeed(server.URL+"/feed/atom", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 {
+		t.Fatal("unexpected items", items)
+	}
+	if items[0].TorrentURL != server.URL+"/download/2" || items[0].Link != server.URL+"/torrent/2" {
+		t.Error("relative urls not resolved", items[0])
+	}
+	if items[1].TorrentURL != testMagnet {
+		t.Error("magnet link must be kept as is", items[1])
+	}
+}
+
+func TestFeedItemExist(t *testing.T) {
+	cr, closeDB := testObserver(t)
+	defer closeDB()
+	source, err := cr.DB.AddSource("feed", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err = cr.DB.AddFeedItem(source, "item-1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if exist, err := cr.DB.GetFeedItemExist(source, "item-1"); err != nil || !exist {
+		t.Error("stored item not found", err)
+	}
+	if exist, err := cr.DB.GetFeedItemExist(source, "item-2"); err != nil || exist {
+		t.Error("unexpected item found", err)
+	}
+}
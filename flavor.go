@@ -0,0 +1,92 @@
+/*
+ * BSD-3-Clause
+ * Copyright 2020 sot (PR_713, C_rho_272)
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ * 1. Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ * this list of conditions and the following disclaimer in the documentation and/or
+ * other materials provided with the distribution.
+ * 3. Neither the name of the copyright holder nor the names of its contributors
+ * may be used to endorse or promote products derived from this software without
+ * specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+ * IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+ * BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+ * OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+ * WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY
+ * OF SUCH DAMAGE.
+ */
+
+package TtKVC
+
+import (
+	"sort"
+	"strings"
+)
+
+const (
+	kFlavorStatusReady   = 2
+	defaultFlavorMaxSize = 2000 * 1024 * 1024
+)
+
+type FlavorPolicy struct {
+	MaxHeight    uint     `json:"maxheight"`
+	MaxSize      uint64   `json:"maxsize"`
+	Codecs       []string `json:"codecs"`
+	Containers   []string `json:"containers"`
+	SkipOriginal bool     `json:"skiporiginal"`
+}
+
+func preferenceIndex(preferred []string, value string) int {
+	for i, p := range preferred {
+		if strings.EqualFold(p, value) {
+			return i
+		}
+	}
+	return len(preferred)
+}
+
+func (p FlavorPolicy) fits(flavor KFlavorAsset) bool {
+	maxSize := p.MaxSize
+	if maxSize == 0 {
+		maxSize = defaultFlavorMaxSize
+	}
+	return flavor.Status == kFlavorStatusReady &&
+		!(p.SkipOriginal && flavor.IsOriginal) &&
+		!strings.Contains(flavor.Tags, kAudioOnlyTag) &&
+		(p.MaxHeight == 0 || flavor.Height <= p.MaxHeight) &&
+		flavor.Size*1024 <= maxSize
+}
+
+func (p FlavorPolicy) choose(flavors []KFlavorAsset) (KFlavorAsset, bool) {
+	candidates := make([]KFlavorAsset, 0, len(flavors))
+	for _, flavor := range flavors {
+		if p.fits(flavor) {
+			candidates = append(candidates, flavor)
+		}
+	}
+	if len(candidates) == 0 {
+		return KFlavorAsset{}, false
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if ai, bi := preferenceIndex(p.Codecs, a.VideoCodecID), preferenceIndex(p.Codecs, b.VideoCodecID); ai != bi {
+			return ai < bi
+		}
+		if ai, bi := preferenceIndex(p.Containers, a.ContainerFormat), preferenceIndex(p.Containers, b.ContainerFormat); ai != bi {
+			return ai < bi
+		}
+		if a.Height != b.Height {
+			return a.Height > b.Height
+		}
+		return a.Bitrate > b.Bitrate
+	})
+	return candidates[0], true
+}
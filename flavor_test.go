@@ -0,0 +1,125 @@
+/*
+ * BSD-3-Clause
+ * Copyright 2020 sot (PR_713, C_rho_272)
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ * 1. Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ * this list of conditions and the following disclaimer in the documentation and/or
+ * other materials provided with the distribution.
+ * 3. Neither the name of the copyright holder nor the names of its contributors
+ * may be used to endorse or promote products derived from this software without
+ * specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+ * IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+ * BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+ * OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+ * WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY
+ * OF SUCH DAMAGE.
+ */
+
+package TtKVC
+
+import (
+	"testing"
+)
+
+func testFlavor(id, codec, container string, height, bitrate uint, size uint64) KFlavorAsset {
+	return KFlavorAsset{
+		KObject:         KObject{Id: id},
+		Height:          height,
+		Bitrate:         bitrate,
+		ContainerFormat: container,
+		VideoCodecID:    codec,
+		Status:          kFlavorStatusReady,
+		Size:            size,
+	}
+}
+
+func TestFlavorPolicyChoose(t *testing.T) {
+	original := testFlavor("original", "h265", "mkv", 1080, 8000, 1024)
+	original.IsOriginal = true
+	audio := testFlavor("audio", "", "mp4", 0, 9000, 1024)
+	audio.Tags = "audio_only,mobile"
+	converting := testFlavor("converting", "avc1", "mp4", 1080, 9000, 1024)
+	converting.Status = 1
+	tests := []struct {
+		name    string
+		policy  FlavorPolicy
+		flavors []KFlavorAsset
+		id      string
+	}{
+		{
+			name:    "default size limit",
+			flavors: []KFlavorAsset{testFlavor("big", "avc1", "mp4", 720, 2000, defaultFlavorMaxSize/1024+1), testFlavor("limit", "avc1", "mp4", 480, 1000, defaultFlavorMaxSize/1024)},
+			id:      "limit",
+		},
+		{
+			name:    "size limit in bytes",
+			policy:  FlavorPolicy{MaxSize: 10 * 1024 * 1024},
+			flavors: []KFlavorAsset{testFlavor("big", "avc1", "mp4", 720, 2000, 10*1024+1), testFlavor("small", "avc1", "mp4", 480, 1000, 10*1024)},
+			id:      "small",
+		},
+		{
+			name:    "original",
+			flavors: []KFlavorAsset{original, testFlavor("web", "avc1", "mp4", 720, 2000, 1024)},
+			id:      "original",
+		},
+		{
+			name:    "skip original",
+			policy:  FlavorPolicy{SkipOriginal: true},
+			flavors: []KFlavorAsset{original, testFlavor("web", "avc1", "mp4", 720, 2000, 1024)},
+			id:      "web",
+		},
+		{
+			name:    "audio only and not ready",
+			flavors: []KFlavorAsset{audio, converting, testFlavor("web", "avc1", "mp4", 360, 500, 1024)},
+			id:      "web",
+		},
+		{
+			name:    "max height",
+			policy:  FlavorPolicy{MaxHeight: 720},
+			flavors: []KFlavorAsset{testFlavor("hd", "avc1", "mp4", 1080, 4000, 1024), testFlavor("sd", "avc1", "mp4", 720, 2000, 1024)},
+			id:      "sd",
+		},
+		{
+			name:    "codec before height",
+			policy:  FlavorPolicy{Codecs: []string{"AVC1", "hev1"}},
+			flavors: []KFlavorAsset{testFlavor("vp9", "vp9", "webm", 1080, 4000, 1024), testFlavor("hevc", "hev1", "mp4", 1080, 3000, 1024), testFlavor("avc", "avc1", "mp4", 480, 1000, 1024)},
+			id:      "avc",
+		},
+		{
+			name:    "container before height",
+			policy:  FlavorPolicy{Codecs: []string{"avc1"}, Containers: []string{"mp4"}},
+			flavors: []KFlavorAsset{testFlavor("mkv", "avc1", "mkv", 1080, 4000, 1024), testFlavor("mp4", "avc1", "mp4", 720, 2000, 1024)},
+			id:      "mp4",
+		},
+		{
+			name:    "height then bitrate",
+			flavors: []KFlavorAsset{testFlavor("sd", "avc1", "mp4", 480, 9000, 1024), testFlavor("low", "avc1", "mp4", 720, 1000, 1024), testFlavor("high", "avc1", "mp4", 720, 2000, 1024)},
+			id:      "high",
+		},
+		{
+			name:    "none fits",
+			policy:  FlavorPolicy{SkipOriginal: true},
+			flavors: []KFlavorAsset{original, audio, converting},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			flavor, found := test.policy.choose(test.flavors)
+			if found != !isEmpty(test.id) {
+				t.Fatal("unexpected found", found, flavor.Id)
+			}
+			if flavor.Id != test.id {
+				t.Errorf("chosen flavor %s, want %s", flavor.Id, test.id)
+			}
+		})
+	}
+}
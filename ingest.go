@@ -0,0 +1,104 @@
+/*
+ * BSD-3-Clause
+ * Copyright 2020 sot (PR_713, C_rho_272)
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ * 1. Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ * this list of conditions and the following disclaimer in the documentation and/or
+ * other materials provided with the distribution.
+ * 3. Neither the name of the copyright holder nor the names of its contributors
+ * may be used to endorse or promote products derived from this software without
+ * specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+ * IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+ * BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+ * OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+ * WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY
+ * OF SUCH DAMAGE.
+ */
+
+package TtKVC
+
+import (
+	"sync"
+	"time"
+)
+
+const defaultIngestWorkers = 1
+
+type ingestJob struct {
+	file     TorrentFile
+	fullPath string
+	size     int64
+}
+
+type ingestQueue struct {
+	mutex    sync.Mutex
+	inFlight map[int64]bool
+	jobs     chan ingestJob
+}
+
+func (q *ingestQueue) push(file TorrentFile, fullPath string, size int64) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.inFlight[file.Id] {
+		return false
+	}
+	select {
+	case q.jobs <- ingestJob{file: file, fullPath: fullPath, size: size}:
+		q.inFlight[file.Id] = true
+		return true
+	default:
+		return false
+	}
+}
+
+func (q *ingestQueue) done(id int64) {
+	q.mutex.Lock()
+	delete(q.inFlight, id)
+	q.mutex.Unlock()
+}
+
+func (q *ingestQueue) isInFlight(id int64) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.inFlight[id]
+}
+
+func (cr *Observer) startIngest() {
+	workers := cr.Kaltura.Workers
+	if workers == 0 {
+		workers = defaultIngestWorkers
+	}
+	delay := cr.Kaltura.Delay
+	if delay == 0 {
+		delay = cr.Crawler.Delay
+	}
+	cr.ingest = &ingestQueue{
+		inFlight: make(map[int64]bool),
+		jobs:     make(chan ingestJob, workers),
+	}
+	logger.Debugf("Starting %d kaltura upload workers", workers)
+	for i := uint(0); i < workers; i++ {
+		go func() {
+			for job := range cr.ingest.jobs {
+				cr.uploadFile(job.file, job.fullPath, job.size)
+				cr.ingest.done(job.file.Id)
+			}
+		}()
+	}
+	go func() {
+		for {
+			cr.checkVideo()
+			logger.Debugf("Next video check in %d sec", delay)
+			time.Sleep(time.Duration(delay) * time.Second)
+		}
+	}()
+}
@@ -37,8 +37,9 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
-	"time"
+	"sync"
 )
 
 const (
@@ -50,21 +51,58 @@ const (
 	kAPIMediaAdd               = "api_v3/service/media/action/add?format=1&ks=%s"
 	kAPIMediaAddContent        = "api_v3/service/media/action/addContent?format=1&ks=%s"
 	kAPIFlavorsList            = "api_v3/service/flavorAsset/action/List?format=1&ks=%s"
+	kAPIFlavorGetURL           = "api_v3/service/flavorAsset/action/getUrl?format=1&ks=%s"
+	kAPIUploadTokenAdd         = "api_v3/service/uploadToken/action/add?format=1&ks=%s"
+	kAPIUploadTokenGet         = "api_v3/service/uploadToken/action/get?format=1&ks=%s"
+	kAPIUploadTokenUpload      = "api_v3/service/uploadToken/action/upload?format=1&ks=%s"
+	kAPIMetadataList           = "api_v3/service/metadata_metadata/action/list?format=1&ks=%s"
+	kAPIMetadataAdd            = "api_v3/service/metadata_metadata/action/add?format=1&ks=%s"
+	kAPIMetadataUpdate         = "api_v3/service/metadata_metadata/action/update?format=1&ks=%s"
+	kAPICategoryList           = "api_v3/service/category/action/list?format=1&ks=%s"
+	kAPICategoryAdd            = "api_v3/service/category/action/add?format=1&ks=%s"
+	kAPICategoryEntryAdd       = "api_v3/service/categoryEntry/action/add?format=1&ks=%s"
+	kAPIPlaylistAdd            = "api_v3/service/playlist/action/add?format=1&ks=%s"
+	kAPIPlaylistUpdate         = "api_v3/service/playlist/action/update?format=1&ks=%s"
 	kAPIThumbnailContextFormat = "%s/width/%d/height/%d"
+	kAPIThumbnailVidSecFormat  = "%s/vid_sec/%d"
 	kSessionTTL                = 1800
 	kUserSessionType           = 0
+	kAdminSessionType          = 2
 	kVideoMediaType            = 1
 	kFileSourceType            = "1"
 	KEntryStatusReady          = 2
 	kEntryIdField              = "entryId"
+	kUploadTokenIdField        = "uploadTokenId"
+	kUploadTokenFullUpload     = 2
+	kDefaultChunkSize          = 16 * 1024 * 1024
+	kMetadataEntryObjectType   = "1"
+	kStaticPlaylistType        = 3
+	kCategoryDelimiter         = ">"
+
+	KErrInvalidKS          = "INVALID_KS"
+	KErrExpiredKS          = "EXPIRED_KS"
+	KErrEntryNotFound      = "ENTRY_ID_NOT_FOUND"
+	KErrServiceForbidden   = "SERVICE_FORBIDDEN"
+	KErrCategoryEntryExist = "CATEGORY_ENTRY_ALREADY_EXISTS"
 )
 
 type Kaltura struct {
-	URL       string `json:"url"`
-	PartnerId uint   `json:"partnerid"`
-	UserId    string `json:"userid"`
-	Secret    string `json:"secret"`
-	session   string
+	URL          string `json:"url"`
+	PartnerId    uint   `json:"partnerid"`
+	UserId       string `json:"userid"`
+	Secret       string `json:"secret"`
+	Auth         string `json:"auth"`
+	Admin        bool   `json:"admin"`
+	Privileges   string `json:"privileges"`
+	AppTokenId   string `json:"apptokenid"`
+	AppToken     string `json:"apptoken"`
+	AppTokenHash string `json:"apptokenhash"`
+	ChunkSize    uint64 `json:"chunksize"`
+	session      string
+	mutex        sync.RWMutex
+	renew        sync.Mutex
+	categories   map[string]int64
+	catMutex     sync.Mutex
 }
 
 type KSession struct {
@@ -143,6 +181,60 @@ type KFlavorAsset struct {
 	UpdatedAt       int64   `json:"updatedAt"`
 }
 
+type KUploadToken struct {
+	KObject
+	Status           int     `json:"status,omitempty"`
+	FileName         string  `json:"fileName,omitempty"`
+	FileSize         float64 `json:"fileSize,omitempty"`
+	UploadedFileSize float64 `json:"uploadedFileSize,omitempty"`
+}
+
+type KMetadata struct {
+	Id                int64  `json:"id"`
+	MetadataProfileId int64  `json:"metadataProfileId"`
+	ObjectId          string `json:"objectId"`
+	Version           int    `json:"version"`
+	XML               string `json:"xml"`
+}
+
+type KMetadataListResponse struct {
+	TotalCount uint64      `json:"totalCount"`
+	Objects    []KMetadata `json:"objects"`
+}
+
+type kMetadataFilter struct {
+	ObjectType              string `json:"objectType"`
+	MetadataProfileIdEqual  int64  `json:"metadataProfileIdEqual"`
+	MetadataObjectTypeEqual string `json:"metadataObjectTypeEqual"`
+	ObjectIdEqual           string `json:"objectIdEqual"`
+}
+
+type KCategory struct {
+	Id         int64  `json:"id,omitempty"`
+	ObjectType string `json:"objectType,omitempty"`
+	Name       string `json:"name,omitempty"`
+	FullName   string `json:"fullName,omitempty"`
+	ParentId   int64  `json:"parentId,omitempty"`
+}
+
+type KCategoryListResponse struct {
+	TotalCount uint64      `json:"totalCount"`
+	Objects    []KCategory `json:"objects"`
+}
+
+type kCategoryFilter struct {
+	ObjectType    string `json:"objectType"`
+	FullNameEqual string `json:"fullNameEqual"`
+}
+
+type KPlaylist struct {
+	KBaseEntry
+	PlaylistType    int    `json:"playlistType,omitempty"`
+	PlaylistContent string `json:"playlistContent,omitempty"`
+}
+
+type KUploadProgress func(tokenId string, offset int64) error
+
 type KError struct {
 	Code       string      `json:"code"`
 	Message    string      `json:"message"`
@@ -150,6 +242,26 @@ type KError struct {
 	Args       interface{} `json:"args"`
 }
 
+func (e *KError) Error() string {
+	if isEmpty(e.Code) {
+		return e.ObjectType + ":" + e.Message
+	}
+	return e.ObjectType + ":" + e.Code + ":" + e.Message
+}
+
+func (e *KError) IsAuth() bool {
+	return e.Code == KErrInvalidKS || e.Code == KErrExpiredKS
+}
+
+func (e *KError) IsPermanent() bool {
+	return e.Code == KErrEntryNotFound || e.Code == KErrServiceForbidden
+}
+
+func isKAuthError(err error) bool {
+	var kErr *KError
+	return errors.As(err, &kErr) && kErr.IsAuth()
+}
+
 func (kl *Kaltura) prepareURL(context string) string {
 	delimiter := ""
 	if strings.LastIndexByte(kl.URL, '/') != len(kl.URL)-1 {
@@ -173,37 +285,57 @@ func (kl *Kaltura) postJson(context string, obj interface{}) ([]byte, error) {
 	return data, err
 }
 
+func (kl *Kaltura) getSession() string {
+	kl.mutex.RLock()
+	defer kl.mutex.RUnlock()
+	return kl.session
+}
+
+func (kl *Kaltura) setSession(session string) {
+	kl.mutex.Lock()
+	kl.session = session
+	kl.mutex.Unlock()
+}
+
 func (kl *Kaltura) CreateSession() error {
-	if !isEmpty(kl.session) {
+	if !isEmpty(kl.getSession()) {
 		kl.EndSession()
 	}
 	var err error
-	obj := KSession{
-		Secret:     kl.Secret,
-		UserID:     kl.UserId,
-		Type:       kUserSessionType,
-		PartnerID:  kl.PartnerId,
-		Expiry:     time.Now().Unix() + kSessionTTL,
-		Privileges: "*",
+	var ks string
+	switch kl.Auth {
+	case KAuthAppToken:
+		ks, err = kl.startAppTokenSession()
+	case KAuthKSv2:
+		ks, err = kl.generateKSv2()
+	default:
+		ks, err = kl.startSecretSession()
 	}
-	var data []byte
-	if data, err = kl.postJson(kAPISessionStart, obj); err == nil {
-		if err = jsonError(data); err == nil {
-			kl.session = strings.Replace(string(data), "\"", "", -1)
-			err = nil
-		}
+	if err == nil {
+		kl.setSession(ks)
 	}
 	return err
 }
 
+func (kl *Kaltura) renewSession(expired string) error {
+	kl.renew.Lock()
+	defer kl.renew.Unlock()
+	if kl.getSession() != expired {
+		return nil
+	}
+	logger.Info("Kaltura session expired, renewing")
+	kl.setSession("")
+	return kl.CreateSession()
+}
+
 func (kl *Kaltura) EndSession() {
-	if !isEmpty(kl.session) {
+	if !isEmpty(kl.getSession()) {
 		fullUrl := kl.prepareURL(kAPISessionEnd)
-		fullUrl = fmt.Sprintf(fullUrl, kl.session)
+		fullUrl = fmt.Sprintf(fullUrl, kl.getSession())
 		if resp, err := http.Get(fullUrl); !checkResponse(resp, err) {
 			logger.Error(responseError(resp, err))
 		}
-		kl.session = ""
+		kl.setSession("")
 	}
 }
 
@@ -212,11 +344,11 @@ var dummy = struct{}{}
 func (kl *Kaltura) GetSession() (KSessionInfo, error) {
 	var err error
 	res := KSessionInfo{}
-	if isEmpty(kl.session) {
+	if isEmpty(kl.getSession()) {
 		err = errors.New("unauthorized")
 	} else {
 		if err = kl.kSend(kAPISessionGet, dummy, &res); err != nil {
-			kl.session = ""
+			kl.setSession("")
 		}
 		return res, err
 	}
@@ -228,12 +360,12 @@ type kFlavorByEntryFilter struct {
 	EntryId string `json:"entryIdEqual"`
 }
 
-func (kl *Kaltura) kSend(context string, send interface{}, result interface{}) error {
+func (kl *Kaltura) kSendSession(session, context string, send interface{}, result interface{}) error {
 	var err error
-	if isEmpty(kl.session) {
+	if isEmpty(session) {
 		return errors.New("empty session")
 	}
-	fullContext := fmt.Sprintf(context, kl.session)
+	fullContext := fmt.Sprintf(context, session)
 	var data []byte
 	if data, err = kl.postJson(fullContext, send); err == nil {
 		if err = jsonError(data); err == nil {
@@ -243,6 +375,17 @@ func (kl *Kaltura) kSend(context string, send interface{}, result interface{}) e
 	return err
 }
 
+func (kl *Kaltura) kSend(context string, send interface{}, result interface{}) error {
+	session := kl.getSession()
+	err := kl.kSendSession(session, context, send, result)
+	if isKAuthError(err) {
+		if err = kl.renewSession(session); err == nil {
+			err = kl.kSendSession(kl.getSession(), context, send, result)
+		}
+	}
+	return err
+}
+
 func (kl *Kaltura) GetMediaEntryFlavorAssets(id string) (KFlavorAssetSearchResult, error) {
 	var err error
 	var res KFlavorAssetSearchResult
@@ -256,6 +399,12 @@ func (kl *Kaltura) GetMediaEntryFlavorAssets(id string) (KFlavorAssetSearchResul
 	return res, err
 }
 
+func (kl *Kaltura) GetFlavorURL(id string) (string, error) {
+	var url string
+	err := kl.kSend(kAPIFlavorGetURL, map[string]string{"id": id}, &url)
+	return url, err
+}
+
 func (kl *Kaltura) GetMediaEntry(id string) (KMediaEntry, error) {
 	var err error
 	var entry KMediaEntry
@@ -278,7 +427,7 @@ func (kl *Kaltura) CreateMediaEntry(path, name string, tags []string) (string, e
 		for _, tag := range tags {
 			if isFirst {
 				isFirst = false
-			} else{
+			} else {
 				cTags.WriteRune(',')
 			}
 			cTags.WriteString(tag)
@@ -309,12 +458,159 @@ func (kl *Kaltura) CreateMediaEntry(path, name string, tags []string) (string, e
 	return entryId, err
 }
 
+func (kl *Kaltura) GetEntryMetadata(entryId string, profileId int64) (*KMetadata, error) {
+	var err error
+	var res KMetadataListResponse
+	var metadata *KMetadata
+	obj := KFilter{Filter: kMetadataFilter{
+		ObjectType:              "KalturaMetadataFilter",
+		MetadataProfileIdEqual:  profileId,
+		MetadataObjectTypeEqual: kMetadataEntryObjectType,
+		ObjectIdEqual:           entryId,
+	}}
+	if err = kl.kSend(kAPIMetadataList, obj, &res); err == nil && len(res.Objects) > 0 {
+		metadata = &res.Objects[0]
+	}
+	return metadata, err
+}
+
+func (kl *Kaltura) SetEntryMetadata(entryId string, profileId int64, xmlData string) error {
+	var err error
+	var metadata *KMetadata
+	if metadata, err = kl.GetEntryMetadata(entryId, profileId); err == nil {
+		res := KMetadata{}
+		if metadata == nil {
+			err = kl.kSend(kAPIMetadataAdd, map[string]interface{}{
+				"metadataProfileId": profileId,
+				"objectType":        kMetadataEntryObjectType,
+				"objectId":          entryId,
+				"xmlData":           xmlData,
+			}, &res)
+		} else if metadata.XML != xmlData {
+			err = kl.kSend(kAPIMetadataUpdate, map[string]interface{}{
+				"id":      metadata.Id,
+				"xmlData": xmlData,
+			}, &res)
+		}
+	}
+	return err
+}
+
+func (kl *Kaltura) getCategory(fullName string) (int64, error) {
+	var err error
+	var res KCategoryListResponse
+	id := int64(0)
+	obj := KFilter{Filter: kCategoryFilter{
+		ObjectType:    "KalturaCategoryFilter",
+		FullNameEqual: fullName,
+	}}
+	if err = kl.kSend(kAPICategoryList, obj, &res); err == nil && len(res.Objects) > 0 {
+		id = res.Objects[0].Id
+	}
+	return id, err
+}
+
+func (kl *Kaltura) GetOrCreateCategory(path []string) (int64, error) {
+	kl.catMutex.Lock()
+	defer kl.catMutex.Unlock()
+	if kl.categories == nil {
+		kl.categories = make(map[string]int64)
+	}
+	var err error
+	var parentId int64
+	fullName := ""
+	for i, name := range path {
+		if i > 0 {
+			fullName += kCategoryDelimiter
+		}
+		fullName += name
+		id, cached := kl.categories[fullName]
+		if !cached {
+			if id, err = kl.getCategory(fullName); err != nil {
+				break
+			}
+			if id == 0 {
+				logger.Info("Creating kaltura category", fullName)
+				category := KCategory{}
+				if err = kl.kSend(kAPICategoryAdd, map[string]interface{}{
+					"category": KCategory{
+						ObjectType: "KalturaCategory",
+						Name:       name,
+						ParentId:   parentId,
+					},
+				}, &category); err != nil {
+					break
+				}
+				id = category.Id
+			}
+			kl.categories[fullName] = id
+		}
+		parentId = id
+	}
+	return parentId, err
+}
+
+func (kl *Kaltura) AddEntryToCategory(entryId string, categoryId int64) error {
+	res := map[string]interface{}{}
+	err := kl.kSend(kAPICategoryEntryAdd, map[string]interface{}{
+		"categoryEntry": map[string]interface{}{
+			"objectType": "KalturaCategoryEntry",
+			"categoryId": categoryId,
+			"entryId":    entryId,
+		},
+	}, &res)
+	var kErr *KError
+	if errors.As(err, &kErr) && kErr.Code == KErrCategoryEntryExist {
+		err = nil
+	}
+	return err
+}
+
+func (kl *Kaltura) SetPlaylist(id, name string, entries []string) (string, error) {
+	var err error
+	res := KPlaylist{}
+	content := strings.Join(entries, ",")
+	if isEmpty(id) {
+		err = kl.kSend(kAPIPlaylistAdd, map[string]interface{}{
+			"playlist": KPlaylist{
+				KBaseEntry: KBaseEntry{
+					KObject: KObject{
+						Name:       name,
+						ObjectType: "KalturaPlaylist",
+					},
+					UserId:    kl.UserId,
+					CreatorId: kl.UserId,
+				},
+				PlaylistType:    kStaticPlaylistType,
+				PlaylistContent: content,
+			},
+		}, &res)
+		if err == nil && isEmpty(res.Id) {
+			err = errors.New("unable to get playlist id")
+		}
+	} else {
+		err = kl.kSend(kAPIPlaylistUpdate, map[string]interface{}{
+			"id": id,
+			"playlist": KPlaylist{
+				KBaseEntry: KBaseEntry{
+					KObject: KObject{
+						ObjectType: "KalturaPlaylist",
+					},
+				},
+				PlaylistContent: content,
+			},
+		}, &res)
+		res.Id = id
+	}
+	return res.Id, err
+}
+
 func jsonError(data []byte) error {
 	var err error
-	outErr := KError{}
-	if err = json.Unmarshal(data, &outErr); err == nil {
+	outErr := &KError{}
+	if err = json.Unmarshal(data, outErr); err == nil {
 		if strings.Contains(outErr.ObjectType, "Exception") || !isEmpty(outErr.Code) {
-			err = errors.New(outErr.ObjectType + ":" + outErr.Message)
+			err = outErr
 		}
 	} else {
 		err = nil
@@ -322,73 +618,194 @@ func jsonError(data []byte) error {
 	return err
 }
 
-func (kl *Kaltura) UploadMediaContent(name, entryId string) error {
-	if isEmpty(kl.session) {
-		return errors.New("empty session")
-	}
+func (kl *Kaltura) postMultipart(context string, fields map[string]string, fileName string, content io.Reader) ([]byte, error) {
 	r, w := io.Pipe()
 	defer r.Close()
 	m := multipart.NewWriter(w)
-	var err error
 	go func() {
-		defer w.Close()
-		defer m.Close()
-		if err == nil {
-			if err := m.WriteField(kEntryIdField, entryId); err != nil {
-				logger.Error(err)
-				return
-			}
-			if err := m.WriteField("resource:objectType", "KalturaUploadedFileResource"); err != nil {
-				logger.Error(err)
-				return
+		var err error
+		for k, v := range fields {
+			if err = m.WriteField(k, v); err != nil {
+				break
 			}
-			name = filepath.Clean(name)
-			part, err := m.CreateFormFile("resource:fileData", filepath.Base(name))
-			if err != nil {
-				logger.Error(err)
-				return
-			}
-			file, err := os.Open(name)
-			if err != nil {
-				logger.Error(err)
-				return
-			}
-			if file != nil {
-				if _, err = io.Copy(part, file); err != nil {
-					logger.Error(err)
-				}
-				if err = file.Close(); err != nil{
-					logger.Error(err)
+		}
+		if err == nil {
+			var part io.Writer
+			if part, err = m.CreateFormFile("fileData", fileName); err == nil {
+				if _, err = io.Copy(part, content); err == nil {
+					err = m.Close()
 				}
-			} else {
-				logger.Error("File object is nil")
 			}
 		}
+		_ = w.CloseWithError(err)
 	}()
-	fullUrl := kl.prepareURL(kAPIMediaAddContent)
-	fullUrl = fmt.Sprintf(fullUrl, kl.session)
+	var err error
+	var data []byte
 	var resp *http.Response
-	if resp, err = http.Post(fullUrl, m.FormDataContentType(), r); checkResponse(resp, err) {
+	if resp, err = http.Post(kl.prepareURL(context), m.FormDataContentType(), r); checkResponse(resp, err) {
 		defer resp.Body.Close()
-		var data []byte
 		if data, err = ioutil.ReadAll(resp.Body); err == nil {
-			if err = jsonError(data); err == nil {
-				entry := KMediaEntry{}
-				if err = json.Unmarshal(data, &entry); err == nil {
-					logger.Debug(entry)
-				}
-			}
+			err = jsonError(data)
 		}
 	} else {
 		err = responseError(resp, err)
 	}
+	return data, err
+}
+
+func (kl *Kaltura) chunkSize() int64 {
+	if kl.ChunkSize == 0 {
+		return kDefaultChunkSize
+	}
+	return int64(kl.ChunkSize)
+}
+
+func (kl *Kaltura) addUploadToken(fileName string, size int64) (KUploadToken, error) {
+	var token KUploadToken
+	obj := map[string]interface{}{
+		"uploadToken": KUploadToken{
+			KObject: KObject{
+				ObjectType: "KalturaUploadToken",
+			},
+			FileName: fileName,
+			FileSize: float64(size),
+		},
+	}
+	err := kl.kSend(kAPIUploadTokenAdd, obj, &token)
+	if err == nil && isEmpty(token.Id) {
+		err = errors.New("unable to get upload token id")
+	}
+	return token, err
+}
+
+func (kl *Kaltura) getUploadToken(id string) (KUploadToken, error) {
+	var token KUploadToken
+	err := kl.kSend(kAPIUploadTokenGet, map[string]string{kUploadTokenIdField: id}, &token)
+	return token, err
+}
+
+func (kl *Kaltura) uploadChunk(id, fileName string, file io.ReaderAt, offset, length int64, final bool) (KUploadToken, error) {
+	session := kl.getSession()
+	token, err := kl.uploadChunkSession(session, id, fileName, io.NewSectionReader(file, offset, length), offset, final)
+	if isKAuthError(err) {
+		if err = kl.renewSession(session); err == nil {
+			token, err = kl.uploadChunkSession(kl.getSession(), id, fileName, io.NewSectionReader(file, offset, length), offset, final)
+		}
+	}
+	return token, err
+}
+
+func (kl *Kaltura) uploadChunkSession(session, id, fileName string, chunk io.Reader, offset int64, final bool) (KUploadToken, error) {
+	var err error
+	var data []byte
+	var token KUploadToken
+	if isEmpty(session) {
+		return token, errors.New("empty session")
+	}
+	resumeAt := "-1"
+	if offset > 0 {
+		resumeAt = strconv.FormatInt(offset, 10)
+	}
+	fields := map[string]string{
+		kUploadTokenIdField: id,
+		"resume":            strconv.FormatBool(offset > 0),
+		"resumeAt":          resumeAt,
+		"finalChunk":        strconv.FormatBool(final),
+	}
+	if data, err = kl.postMultipart(fmt.Sprintf(kAPIUploadTokenUpload, session), fields, fileName, chunk); err == nil {
+		err = json.Unmarshal(data, &token)
+	}
+	return token, err
+}
+
+func (kl *Kaltura) UploadFile(name, tokenId string, offset int64, progress KUploadProgress) (string, error) {
+	var err error
+	var file *os.File
+	var stat os.FileInfo
+	if isEmpty(kl.getSession()) {
+		return "", errors.New("empty session")
+	}
+	name = filepath.Clean(name)
+	if file, err = os.Open(name); err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if stat, err = file.Stat(); err != nil {
+		return "", err
+	}
+	size, fileName := stat.Size(), filepath.Base(name)
+	if !isEmpty(tokenId) {
+		var token KUploadToken
+		if token, err = kl.getUploadToken(tokenId); err == nil && token.Status <= kUploadTokenFullUpload &&
+			(token.FileSize == 0 || int64(token.FileSize) == size) {
+			if token.Status == kUploadTokenFullUpload {
+				offset = size
+			} else {
+				offset = int64(token.UploadedFileSize)
+			}
+			logger.Debugf("Resuming upload of %s with token %s from %d", fileName, tokenId, offset)
+		} else {
+			logger.Warning("Unable to resume upload with token", tokenId, err)
+			tokenId, err = "", nil
+		}
+	}
+	if isEmpty(tokenId) {
+		var token KUploadToken
+		if token, err = kl.addUploadToken(fileName, size); err != nil {
+			return "", err
+		}
+		tokenId, offset = token.Id, 0
+		if progress != nil {
+			if err = progress(tokenId, offset); err != nil {
+				return "", err
+			}
+		}
+	}
+	chunkSize := kl.chunkSize()
+	for offset < size && err == nil {
+		length := chunkSize
+		if offset+length > size {
+			length = size - offset
+		}
+		logger.Debugf("Uploading %s chunk %d-%d of %d", fileName, offset, offset+length, size)
+		if _, err = kl.uploadChunk(tokenId, fileName, file, offset, length, offset+length == size); err == nil {
+			offset += length
+			if progress != nil {
+				err = progress(tokenId, offset)
+			}
+		}
+	}
+	return tokenId, err
+}
+
+func tokenResource(tokenId string) map[string]string {
+	return map[string]string{
+		"objectType": "KalturaUploadedFileTokenResource",
+		"token":      tokenId,
+	}
+}
+
+func (kl *Kaltura) UploadMediaContent(name, entryId, tokenId string, offset int64, progress KUploadProgress) error {
+	var err error
+	if tokenId, err = kl.UploadFile(name, tokenId, offset, progress); err == nil {
+		entry := KMediaEntry{}
+		obj := map[string]interface{}{
+			kEntryIdField: entryId,
+			"resource":    tokenResource(tokenId),
+		}
+		if err = kl.kSend(kAPIMediaAddContent, obj, &entry); err == nil {
+			logger.Debug(entry)
+		}
+	}
 	return err
 }
 
-func FormatThumbnailURL(plainUrl string, width, height uint) string {
-	if width == 0 || height == 0 {
-		return plainUrl
-	} else {
-		return fmt.Sprintf(kAPIThumbnailContextFormat, plainUrl, width, height)
+func FormatThumbnailURL(plainUrl string, width, height, vidSec uint) string {
+	if width != 0 && height != 0 {
+		plainUrl = fmt.Sprintf(kAPIThumbnailContextFormat, plainUrl, width, height)
+	}
+	if vidSec != 0 {
+		plainUrl = fmt.Sprintf(kAPIThumbnailVidSecFormat, plainUrl, vidSec)
 	}
+	return plainUrl
 }
@@ -0,0 +1,258 @@
+/*
+ * BSD-3-Clause
+ * Copyright 2020 sot (PR_713, C_rho_272)
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ * 1. Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ * this list of conditions and the following disclaimer in the documentation and/or
+ * other materials provided with the distribution.
+ * 3. Neither the name of the copyright holder nor the names of its contributors
+ * may be used to endorse or promote products derived from this software without
+ * specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+ * IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+ * BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+ * OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+ * WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY
+ * OF SUCH DAMAGE.
+ */
+
+package TtKVC
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type fakeKalturaToken struct {
+	KUploadToken
+	data []byte
+}
+
+type fakeKaltura struct {
+	mutex    sync.Mutex
+	session  string
+	sessions int
+	expire   bool
+	tokens   map[string]*fakeKalturaToken
+	chunks   []string
+	content  map[string][]byte
+}
+
+func newFakeKaltura() *fakeKaltura {
+	return &fakeKaltura{
+		session: "ks1",
+		tokens:  make(map[string]*fakeKalturaToken),
+		content: make(map[string][]byte),
+	}
+}
+
+func (f *fakeKaltura) writeJson(w http.ResponseWriter, obj interface{}) {
+	data, _ := json.Marshal(obj)
+	_, _ = w.Write(data)
+}
+
+func (f *fakeKaltura) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	service := strings.TrimPrefix(r.URL.Path, "/api_v3/service/")
+	switch service {
+	case "session/action/start":
+		f.sessions++
+		f.session = "ks" + strconv.Itoa(f.sessions+1)
+		f.writeJson(w, f.session)
+		return
+	case "session/action/end":
+		return
+	}
+	if r.URL.Query().Get("ks") != f.session || f.expire {
+		f.expire = false
+		f.writeJson(w, KError{Code: KErrExpiredKS, ObjectType: "KalturaAPIException", Message: "expired"})
+		return
+	}
+	switch service {
+	case "uploadToken/action/add":
+		req := struct {
+			UploadToken KUploadToken `json:"uploadToken"`
+		}{}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		token := &fakeKalturaToken{KUploadToken: req.UploadToken}
+		token.Id = "token" + strconv.Itoa(len(f.tokens)+1)
+		f.tokens[token.Id] = token
+		f.writeJson(w, token.KUploadToken)
+	case "uploadToken/action/get":
+		req := map[string]string{}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if token := f.tokens[req[kUploadTokenIdField]]; token != nil {
+			f.writeJson(w, token.KUploadToken)
+		} else {
+			f.writeJson(w, KError{Code: "UPLOAD_TOKEN_NOT_FOUND", ObjectType: "KalturaAPIException"})
+		}
+	case "uploadToken/action/upload":
+		token := f.tokens[r.FormValue(kUploadTokenIdField)]
+		file, _, err := r.FormFile("fileData")
+		if token == nil || err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		chunk, _ := ioutil.ReadAll(file)
+		_ = file.Close()
+		resumeAt := r.FormValue("resumeAt")
+		f.chunks = append(f.chunks, fmt.Sprintf("%s:%s:%d:%s", r.FormValue("resume"), resumeAt, len(chunk), r.FormValue("finalChunk")))
+		if resumeAt != "-1" && resumeAt != strconv.Itoa(len(token.data)) {
+			f.writeJson(w, KError{Code: "UPLOAD_ERROR", ObjectType: "KalturaAPIException", Message: "wrong offset " + resumeAt})
+			return
+		}
+		token.data = append(token.data, chunk...)
+		token.UploadedFileSize = float64(len(token.data))
+		if r.FormValue("finalChunk") == "true" {
+			token.Status = kUploadTokenFullUpload
+		} else {
+			token.Status = 1
+		}
+		f.writeJson(w, token.KUploadToken)
+	case "media/action/addContent":
+		req := struct {
+			EntryId  string            `json:"entryId"`
+			Resource map[string]string `json:"resource"`
+		}{}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if token := f.tokens[req.Resource["token"]]; token != nil && token.Status == kUploadTokenFullUpload {
+			f.content[req.EntryId] = token.data
+			f.writeJson(w, KMediaEntry{KBaseEntry: KBaseEntry{KObject: KObject{Id: req.EntryId}}})
+		} else {
+			f.writeJson(w, KError{Code: "UPLOADED_FILE_NOT_FOUND_BY_TOKEN", ObjectType: "KalturaAPIException"})
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func testUploadFile(t *testing.T, size int) (string, []byte) {
+	dir, err := ioutil.TempDir("", "ttkvc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	path := filepath.Join(dir, "video.mkv")
+	if err = ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path, data
+}
+
+func testKaltura(server *httptest.Server) *Kaltura {
+	kl := &Kaltura{
+		URL:       server.URL,
+		UserId:    "user",
+		Secret:    "secret",
+		ChunkSize: 10,
+	}
+	kl.setSession("ks1")
+	return kl
+}
+
+func TestKalturaUploadMediaContent(t *testing.T) {
+	fake := newFakeKaltura()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	path, data := testUploadFile(t, 25)
+	defer os.RemoveAll(filepath.Dir(path))
+	kl := testKaltura(server)
+	var offsets []int64
+	err := kl.UploadMediaContent(path, "0_entry", "", 0, func(tokenId string, offset int64) error {
+		if tokenId != "token1" {
+			t.Error("unexpected token", tokenId)
+		}
+		offsets = append(offsets, offset)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(offsets) != "[0 10 20 25]" {
+		t.Error("unexpected progress", offsets)
+	}
+	if expected := []string{"false:-1:10:false", "true:10:10:false", "true:20:5:true"}; fmt.Sprint(fake.chunks) != fmt.Sprint(expected) {
+		t.Error("unexpected chunks", fake.chunks)
+	}
+	if !bytes.Equal(fake.content["0_entry"], data) {
+		t.Error("entry content differs from file")
+	}
+}
+
+func TestKalturaUploadResume(t *testing.T) {
+	fake := newFakeKaltura()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	path, data := testUploadFile(t, 25)
+	defer os.RemoveAll(filepath.Dir(path))
+	fake.tokens["stored"] = &fakeKalturaToken{
+		KUploadToken: KUploadToken{
+			KObject:          KObject{Id: "stored"},
+			Status:           1,
+			FileName:         "video.mkv",
+			FileSize:         25,
+			UploadedFileSize: 10,
+		},
+		data: data[:10],
+	}
+	kl := testKaltura(server)
+	fake.expire = true
+	var offsets []int64
+	err := kl.UploadMediaContent(path, "0_entry", "stored", 10, func(tokenId string, offset int64) error {
+		offsets = append(offsets, offset)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(offsets) != "[20 25]" {
+		t.Error("unexpected progress", offsets)
+	}
+	if expected := []string{"true:10:10:false", "true:20:5:true"}; fmt.Sprint(fake.chunks) != fmt.Sprint(expected) {
+		t.Error("upload not resumed from stored offset", fake.chunks)
+	}
+	if fake.sessions != 1 {
+		t.Error("expected session renewal, got", fake.sessions)
+	}
+	if len(fake.tokens) != 1 || !bytes.Equal(fake.content["0_entry"], data) {
+		t.Error("entry content differs from file")
+	}
+}
+
+func TestKalturaUploadStaleToken(t *testing.T) {
+	fake := newFakeKaltura()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	path, data := testUploadFile(t, 15)
+	defer os.RemoveAll(filepath.Dir(path))
+	kl := testKaltura(server)
+	tokenId, err := kl.UploadFile(path, "missing", 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokenId != "token1" || !bytes.Equal(fake.tokens[tokenId].data, data) {
+		t.Error("expected full upload with new token", tokenId, fake.chunks)
+	}
+}
@@ -0,0 +1,124 @@
+/*
+ * BSD-3-Clause
+ * Copyright 2020 sot (PR_713, C_rho_272)
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ * 1. Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ * this list of conditions and the following disclaimer in the documentation and/or
+ * other materials provided with the distribution.
+ * 3. Neither the name of the copyright holder nor the names of its contributors
+ * may be used to endorse or promote products derived from this software without
+ * specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+ * IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+ * BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+ * OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+ * WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY
+ * OF SUCH DAMAGE.
+ */
+
+package TtKVC
+
+import (
+	"errors"
+)
+
+const (
+	kAPICaptionAssetAdd        = "api_v3/service/caption_captionasset/action/add?format=1&ks=%s"
+	kAPICaptionAssetSetContent = "api_v3/service/caption_captionasset/action/setContent?format=1&ks=%s"
+	kAPIFlavorAssetAdd         = "api_v3/service/flavorAsset/action/add?format=1&ks=%s"
+	kAPIFlavorAssetSetContent  = "api_v3/service/flavorAsset/action/setContent?format=1&ks=%s"
+
+	KCaptionSRT    = "1"
+	KCaptionDFXP   = "2"
+	KCaptionWebVTT = "3"
+
+	kAudioOnlyTag = "audio_only"
+)
+
+type KAsset struct {
+	Id         string `json:"id,omitempty"`
+	ObjectType string `json:"objectType,omitempty"`
+	EntryId    string `json:"entryId,omitempty"`
+	Language   string `json:"language,omitempty"`
+	Label      string `json:"label,omitempty"`
+	Tags       string `json:"tags,omitempty"`
+}
+
+type KCaptionAsset struct {
+	KAsset
+	Format    string `json:"format,omitempty"`
+	IsDefault bool   `json:"isDefault,omitempty"`
+}
+
+type KAudioFlavorAsset struct {
+	KAsset
+	FlavorParamsId int64 `json:"flavorParamsId"`
+}
+
+func (kl *Kaltura) setAssetContent(context, assetId, tokenId string) error {
+	res := KAsset{}
+	return kl.kSend(context, map[string]interface{}{
+		"id":              assetId,
+		"contentResource": tokenResource(tokenId),
+	}, &res)
+}
+
+func (kl *Kaltura) AddCaption(entryId, name, format, language, label string) error {
+	var err error
+	var tokenId string
+	if tokenId, err = kl.UploadFile(name, "", 0, nil); err == nil {
+		asset := KCaptionAsset{}
+		if err = kl.kSend(kAPICaptionAssetAdd, map[string]interface{}{
+			kEntryIdField: entryId,
+			"captionAsset": KCaptionAsset{
+				KAsset: KAsset{
+					ObjectType: "KalturaCaptionAsset",
+					Language:   language,
+					Label:      label,
+				},
+				Format: format,
+			},
+		}, &asset); err == nil {
+			if isEmpty(asset.Id) {
+				err = errors.New("unable to get caption asset id")
+			} else {
+				err = kl.setAssetContent(kAPICaptionAssetSetContent, asset.Id, tokenId)
+			}
+		}
+	}
+	return err
+}
+
+func (kl *Kaltura) AddAudio(entryId, name string, flavorParamsId int64, language, label, tokenId string, offset int64, progress KUploadProgress) error {
+	var err error
+	if tokenId, err = kl.UploadFile(name, tokenId, offset, progress); err == nil {
+		asset := KAudioFlavorAsset{}
+		if err = kl.kSend(kAPIFlavorAssetAdd, map[string]interface{}{
+			kEntryIdField: entryId,
+			"flavorAsset": KAudioFlavorAsset{
+				KAsset: KAsset{
+					ObjectType: "KalturaFlavorAsset",
+					Language:   language,
+					Label:      label,
+					Tags:       kAudioOnlyTag,
+				},
+				FlavorParamsId: flavorParamsId,
+			},
+		}, &asset); err == nil {
+			if isEmpty(asset.Id) {
+				err = errors.New("unable to get flavor asset id")
+			} else {
+				err = kl.setAssetContent(kAPIFlavorAssetSetContent, asset.Id, tokenId)
+			}
+		}
+	}
+	return err
+}
@@ -0,0 +1,209 @@
+/*
+ * BSD-3-Clause
+ * Copyright 2020 sot (PR_713, C_rho_272)
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ * 1. Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ * this list of conditions and the following disclaimer in the documentation and/or
+ * other materials provided with the distribution.
+ * 3. Neither the name of the copyright holder nor the names of its contributors
+ * may be used to endorse or promote products derived from this software without
+ * specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+ * IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+ * BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+ * OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+ * WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY
+ * OF SUCH DAMAGE.
+ */
+
+package TtKVC
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	KAuthSecret   = "secret"
+	KAuthAppToken = "apptoken"
+	KAuthKSv2     = "ks2"
+
+	kAPIWidgetSessionStart   = "api_v3/service/session/action/startWidgetSession?format=1"
+	kAPIAppTokenSessionStart = "api_v3/service/appToken/action/startSession?format=1&ks=%s"
+	kDefaultAppTokenHash     = "SHA1"
+	kKSv2RandomSize          = 16
+)
+
+type kWidgetSession struct {
+	KS        string `json:"ks"`
+	PartnerId uint   `json:"partnerId"`
+	UserId    string `json:"userId"`
+}
+
+func (kl *Kaltura) checkAuth() error {
+	var err error
+	if isEmpty(kl.URL) {
+		err = errors.New("kaltura url not set")
+	} else {
+		switch kl.Auth {
+		case "", KAuthSecret, KAuthKSv2:
+			if isEmpty(kl.UserId) || isEmpty(kl.Secret) {
+				err = errors.New("kaltura user id or secret not set")
+			}
+		case KAuthAppToken:
+			if isEmpty(kl.AppTokenId) || isEmpty(kl.AppToken) {
+				err = errors.New("kaltura app token id or token not set")
+			}
+		default:
+			err = errors.New("unknown kaltura auth mode " + kl.Auth)
+		}
+	}
+	return err
+}
+
+func (kl *Kaltura) sessionType() uint {
+	if kl.Admin {
+		return kAdminSessionType
+	}
+	return kUserSessionType
+}
+
+func (kl *Kaltura) privileges() string {
+	if isEmpty(kl.Privileges) && !kl.Admin {
+		return "*"
+	}
+	return kl.Privileges
+}
+
+func (kl *Kaltura) startSecretSession() (string, error) {
+	var err error
+	var ks string
+	obj := KSession{
+		Secret:     kl.Secret,
+		UserID:     kl.UserId,
+		Type:       kl.sessionType(),
+		PartnerID:  kl.PartnerId,
+		Expiry:     time.Now().Unix() + kSessionTTL,
+		Privileges: kl.privileges(),
+	}
+	var data []byte
+	if data, err = kl.postJson(kAPISessionStart, obj); err == nil {
+		if err = jsonError(data); err == nil {
+			ks = strings.Replace(string(data), "\"", "", -1)
+		}
+	}
+	return ks, err
+}
+
+func appTokenHash(hashType string) (hash.Hash, error) {
+	switch strings.ToUpper(hashType) {
+	case "", kDefaultAppTokenHash:
+		return sha1.New(), nil
+	case "SHA256":
+		return sha256.New(), nil
+	case "SHA512":
+		return sha512.New(), nil
+	case "MD5":
+		return md5.New(), nil
+	default:
+		return nil, errors.New("unsupported app token hash type " + hashType)
+	}
+}
+
+func (kl *Kaltura) startAppTokenSession() (string, error) {
+	var err error
+	var data []byte
+	var h hash.Hash
+	widget := kWidgetSession{}
+	if h, err = appTokenHash(kl.AppTokenHash); err != nil {
+		return "", err
+	}
+	obj := map[string]string{"widgetId": "_" + strconv.FormatUint(uint64(kl.PartnerId), 10)}
+	if data, err = kl.postJson(kAPIWidgetSessionStart, obj); err == nil {
+		if err = jsonError(data); err == nil {
+			err = json.Unmarshal(data, &widget)
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	if isEmpty(widget.KS) {
+		return "", errors.New("unable to start widget session")
+	}
+	h.Write([]byte(widget.KS + kl.AppToken))
+	info := KSessionInfo{}
+	tokenObj := map[string]interface{}{
+		"id":        kl.AppTokenId,
+		"tokenHash": hex.EncodeToString(h.Sum(nil)),
+		"expiry":    kSessionTTL,
+	}
+	if !isEmpty(kl.UserId) {
+		tokenObj["userId"] = kl.UserId
+	}
+	if err = kl.kSendSession(widget.KS, kAPIAppTokenSessionStart, tokenObj, &info); err == nil && isEmpty(info.KS) {
+		err = errors.New("unable to start app token session")
+	}
+	return info.KS, err
+}
+
+func (kl *Kaltura) generateKSv2() (string, error) {
+	fields := url.Values{}
+	for _, privilege := range strings.Split(kl.privileges(), ",") {
+		privilege = strings.TrimSpace(privilege)
+		if isEmpty(privilege) {
+			continue
+		}
+		if privilege == "*" {
+			privilege = "all:*"
+		}
+		if i := strings.IndexByte(privilege, ':'); i >= 0 {
+			fields.Set(privilege[:i], privilege[i+1:])
+		} else {
+			fields.Set(privilege, "")
+		}
+	}
+	fields.Set("_e", strconv.FormatInt(time.Now().Unix()+kSessionTTL, 10))
+	fields.Set("_t", strconv.FormatUint(uint64(kl.sessionType()), 10))
+	fields.Set("_u", kl.UserId)
+	random := make([]byte, kKSv2RandomSize)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	plain := append(random, fields.Encode()...)
+	signature := sha1.Sum(plain)
+	plain = append(signature[:], plain...)
+	if rest := len(plain) % aes.BlockSize; rest != 0 {
+		plain = append(plain, make([]byte, aes.BlockSize-rest)...)
+	}
+	key := sha1.Sum([]byte(kl.Secret))
+	block, err := aes.NewCipher(key[:16])
+	if err != nil {
+		return "", err
+	}
+	encrypted := make([]byte, len(plain))
+	cipher.NewCBCEncrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(encrypted, plain)
+	ks := append([]byte("v2|"+strconv.FormatUint(uint64(kl.PartnerId), 10)+"|"), encrypted...)
+	return base64.RawURLEncoding.EncodeToString(ks), nil
+}
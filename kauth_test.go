@@ -0,0 +1,130 @@
+/*
+ * BSD-3-Clause
+ * Copyright 2020 sot (PR_713, C_rho_272)
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ * 1. Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ * this list of conditions and the following disclaimer in the documentation and/or
+ * other materials provided with the distribution.
+ * 3. Neither the name of the copyright holder nor the names of its contributors
+ * may be used to endorse or promote products derived from this software without
+ * specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+ * IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+ * BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+ * OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+ * WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY
+ * OF SUCH DAMAGE.
+ */
+
+package TtKVC
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"encoding/base64"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func decryptKSv2(t *testing.T, ks, secret, prefix string) url.Values {
+	data, err := base64.RawURLEncoding.DecodeString(ks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte(prefix)) {
+		t.Fatal("unexpected ks prefix", string(data[:len(prefix)]))
+	}
+	encrypted := data[len(prefix):]
+	if len(encrypted) == 0 || len(encrypted)%aes.BlockSize != 0 {
+		t.Fatal("invalid encrypted length", len(encrypted))
+	}
+	key := sha1.Sum([]byte(secret))
+	block, err := aes.NewCipher(key[:16])
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := make([]byte, len(encrypted))
+	cipher.NewCBCDecrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(plain, encrypted)
+	plain = bytes.TrimRight(plain, "\x00")
+	signature, payload := plain[:sha1.Size], plain[sha1.Size:]
+	if sum := sha1.Sum(payload); !bytes.Equal(sum[:], signature) {
+		t.Fatal("invalid ks signature")
+	}
+	fields, err := url.ParseQuery(string(payload[kKSv2RandomSize:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fields
+}
+
+func TestGenerateKSv2(t *testing.T) {
+	tests := []struct {
+		name   string
+		kl     *Kaltura
+		fields map[string]string
+	}{
+		{
+			name:   "user",
+			kl:     &Kaltura{PartnerId: 123, UserId: "user", Secret: "secret"},
+			fields: map[string]string{"all": "*", "_t": strconv.Itoa(kUserSessionType), "_u": "user"},
+		},
+		{
+			name: "admin",
+			kl:   &Kaltura{PartnerId: 456, UserId: "admin", Secret: "admin secret", Admin: true, Privileges: "disableentitlement, sview:entry1"},
+			fields: map[string]string{"disableentitlement": "", "sview": "entry1",
+				"_t": strconv.Itoa(kAdminSessionType), "_u": "admin"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ks, err := test.kl.generateKSv2()
+			if err != nil {
+				t.Fatal(err)
+			}
+			fields := decryptKSv2(t, ks, test.kl.Secret, "v2|"+strconv.FormatUint(uint64(test.kl.PartnerId), 10)+"|")
+			expiry, err := strconv.ParseInt(fields.Get("_e"), 10, 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if now := time.Now().Unix(); expiry < now || expiry > now+kSessionTTL {
+				t.Error("unexpected expiry", expiry)
+			}
+			fields.Del("_e")
+			if len(fields) != len(test.fields) {
+				t.Error("unexpected fields", fields)
+			}
+			for k, v := range test.fields {
+				if val, ok := fields[k]; !ok || len(val) != 1 || val[0] != v {
+					t.Errorf("field %s = %v, want %s", k, val, v)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateKSv2Random(t *testing.T) {
+	kl := Kaltura{PartnerId: 123, UserId: "user", Secret: "secret"}
+	first, err := kl.generateKSv2()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := kl.generateKSv2()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second {
+		t.Error("ks must contain random prefix")
+	}
+}
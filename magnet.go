@@ -0,0 +1,126 @@
+/*
+ * BSD-3-Clause
+ * Copyright 2020 sot (PR_713, C_rho_272)
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ * 1. Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ * this list of conditions and the following disclaimer in the documentation and/or
+ * other materials provided with the distribution.
+ * 3. Neither the name of the copyright holder nor the names of its contributors
+ * may be used to endorse or promote products derived from this software without
+ * specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+ * IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+ * BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+ * OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+ * WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY
+ * OF SUCH DAMAGE.
+ */
+
+package TtKVC
+
+import (
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	magnetScheme    = "magnet"
+	magnetBtihURN   = "urn:btih:"
+	magnetBtmhURN   = "urn:btmh:"
+	sha256Multihash = "1220"
+	btihHexLen      = 40
+	btihBase32Len   = 32
+	magnetTopic     = "xt"
+	magnetName      = "dn"
+	magnetTrackers  = "tr"
+)
+
+var magnetRegexp = regexp.MustCompile(`magnet:\?[^"'<>\s]+`)
+
+type Magnet struct {
+	URI        string
+	InfoHash   string
+	InfoHashV2 string
+	Name       string
+	Trackers   []string
+}
+
+func ParseMagnet(uri string) (*Magnet, error) {
+	var err error
+	var res *Magnet
+	var u *url.URL
+	if u, err = url.Parse(uri); err == nil {
+		if u.Scheme != magnetScheme {
+			return nil, errors.New("not a magnet uri " + uri)
+		}
+		query := u.Query()
+		m := &Magnet{
+			URI:      uri,
+			Name:     query.Get(magnetName),
+			Trackers: query[magnetTrackers],
+		}
+		for _, xt := range query[magnetTopic] {
+			lxt := strings.ToLower(xt)
+			if strings.HasPrefix(lxt, magnetBtihURN) && isEmpty(m.InfoHash) {
+				if m.InfoHash, err = decodeBtih(xt[len(magnetBtihURN):]); err != nil {
+					break
+				}
+			} else if strings.HasPrefix(lxt, magnetBtmhURN+sha256Multihash) && isEmpty(m.InfoHashV2) {
+				hash := lxt[len(magnetBtmhURN)+len(sha256Multihash):]
+				if _, err = hex.DecodeString(hash); err != nil || len(hash) != sha256.Size*2 {
+					err = errors.New("invalid btmh " + xt)
+					break
+				}
+				m.InfoHashV2 = hash
+			}
+		}
+		if err == nil && isEmpty(m.InfoHash) && !isEmpty(m.InfoHashV2) {
+			m.InfoHash = m.InfoHashV2[:btihHexLen]
+		}
+		if err == nil && isEmpty(m.InfoHash) {
+			err = errors.New("info hash not found in magnet uri " + uri)
+		}
+		if err == nil {
+			res = m
+		}
+	}
+	return res, err
+}
+
+func decodeBtih(hash string) (string, error) {
+	var err error
+	var res string
+	switch len(hash) {
+	case btihHexLen:
+		var raw []byte
+		if raw, err = hex.DecodeString(hash); err == nil {
+			res = hex.EncodeToString(raw)
+		}
+	case btihBase32Len:
+		var raw []byte
+		if raw, err = base32.StdEncoding.DecodeString(strings.ToUpper(hash)); err == nil {
+			res = hex.EncodeToString(raw)
+		}
+	default:
+		err = errors.New("invalid btih " + hash)
+	}
+	return res, err
+}
+
+func findMagnet(data []byte) string {
+	return html.UnescapeString(string(magnetRegexp.Find(data)))
+}
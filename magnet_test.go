@@ -0,0 +1,104 @@
+/*
+ * BSD-3-Clause
+ * Copyright 2020 sot (PR_713, C_rho_272)
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ * 1. Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ * this list of conditions and the following disclaimer in the documentation and/or
+ * other materials provided with the distribution.
+ * 3. Neither the name of the copyright holder nor the names of its contributors
+ * may be used to endorse or promote products derived from this software without
+ * specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+ * IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+ * BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+ * OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+ * WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY
+ * OF SUCH DAMAGE.
+ */
+
+package TtKVC
+
+import (
+	"reflect"
+	"testing"
+)
+
+const (
+	testBtih = "c12fe1c06bba254a9dc9f519b335aa7c1367a88a"
+	testBtmh = "d8dd32ac93357c368556af3ac1d95c9d76bd0dff6fa9833ecdac3d53134efabb"
+)
+
+func TestParseMagnet(t *testing.T) {
+	tests := []struct {
+		name   string
+		uri    string
+		magnet *Magnet
+	}{
+		{
+			name: "hex btih",
+			uri:  "magnet:?xt=urn:btih:C12FE1C06BBA254A9DC9F519B335AA7C1367A88A&dn=Show&tr=http%3A%2F%2Ftracker.local%2Fannounce",
+			magnet: &Magnet{
+				InfoHash: testBtih,
+				Name:     "Show",
+				Trackers: []string{"http://tracker.local/announce"},
+			},
+		},
+		{
+			name:   "base32 btih",
+			uri:    "magnet:?xt=urn:btih:yex6dqdlxisuvhoj6um3gnnkpqjwpkek",
+			magnet: &Magnet{InfoHash: testBtih},
+		},
+		{
+			name:   "btmh only",
+			uri:    "magnet:?xt=urn:btmh:1220" + testBtmh,
+			magnet: &Magnet{InfoHash: testBtmh[:btihHexLen], InfoHashV2: testBtmh},
+		},
+		{
+			name:   "hybrid",
+			uri:    "magnet:?xt=urn:btih:" + testBtih + "&xt=urn:btmh:1220" + testBtmh,
+			magnet: &Magnet{InfoHash: testBtih, InfoHashV2: testBtmh},
+		},
+		{name: "invalid btih", uri: "magnet:?xt=urn:btih:c12fe1c06b"},
+		{name: "invalid hex btih", uri: "magnet:?xt=urn:btih:z12fe1c06bba254a9dc9f519b335aa7c1367a88a"},
+		{name: "invalid btmh", uri: "magnet:?xt=urn:btmh:1220" + testBtmh[:10]},
+		{name: "unsupported xt", uri: "magnet:?xt=urn:sha1:YNCKHTQCWBTRNJIV4WNAE52SJUQCZO5C"},
+		{name: "missing xt", uri: "magnet:?dn=Show"},
+		{name: "not magnet", uri: "http://tracker.local/?xt=urn:btih:" + testBtih},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := ParseMagnet(test.uri)
+			if test.magnet == nil {
+				if err == nil {
+					t.Error("expected error, got", m)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.magnet.URI = test.uri
+			if !reflect.DeepEqual(m, test.magnet) {
+				t.Errorf("unexpected magnet\n got: %+v\nwant: %+v", m, test.magnet)
+			}
+		})
+	}
+}
+
+func TestFindMagnet(t *testing.T) {
+	page := []byte(`<a href="magnet:?xt=urn:btih:` + testBtih + `&amp;dn=Show">Magnet</a>`)
+	if uri := findMagnet(page); uri != "magnet:?xt=urn:btih:"+testBtih+"&dn=Show" {
+		t.Error("unexpected magnet", uri)
+	}
+	if uri := findMagnet([]byte(`<a href="/download/1">Torrent</a>`)); uri != "" {
+		t.Error("unexpected magnet", uri)
+	}
+}
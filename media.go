@@ -0,0 +1,183 @@
+/*
+ * BSD-3-Clause
+ * Copyright 2020 sot (PR_713, C_rho_272)
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ * 1. Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ * this list of conditions and the following disclaimer in the documentation and/or
+ * other materials provided with the distribution.
+ * 3. Neither the name of the copyright holder nor the names of its contributors
+ * may be used to endorse or promote products derived from this software without
+ * specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+ * IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+ * BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+ * OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+ * WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY
+ * OF SUCH DAMAGE.
+ */
+
+package TtKVC
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+type MediaInfo struct {
+	Duration       float64
+	VideoCodec     string
+	AudioCodec     string
+	Width          uint
+	Height         uint
+	AudioLanguages string
+	Bitrate        uint64
+}
+
+type ffprobeStream struct {
+	CodecType   string `json:"codec_type"`
+	CodecName   string `json:"codec_name"`
+	Width       uint   `json:"width"`
+	Height      uint   `json:"height"`
+	Duration    string `json:"duration"`
+	Disposition struct {
+		AttachedPic int `json:"attached_pic"`
+	} `json:"disposition"`
+	Tags struct {
+		Language string `json:"language"`
+	} `json:"tags"`
+}
+
+type ffprobeOutput struct {
+	Streams []ffprobeStream `json:"streams"`
+	Format  struct {
+		Duration string `json:"duration"`
+		BitRate  string `json:"bit_rate"`
+	} `json:"format"`
+}
+
+var errNotMedia = errors.New("no video stream found")
+
+func (m MediaInfo) IsVideo() bool {
+	return !isEmpty(m.VideoCodec) && m.Width > 0 && m.Height > 0 && m.Duration > 0
+}
+
+func (m MediaInfo) templateData() map[string]interface{} {
+	duration := uint64(m.Duration)
+	return map[string]interface{}{
+		"duration":   duration,
+		"length":     fmt.Sprintf("%d:%02d:%02d", duration/3600, duration/60%60, duration%60),
+		"videocodec": m.VideoCodec,
+		"audiocodec": m.AudioCodec,
+		"width":      m.Width,
+		"height":     m.Height,
+		"resolution": fmt.Sprintf("%dx%d", m.Width, m.Height),
+		"languages":  m.AudioLanguages,
+		"bitrate":    m.Bitrate,
+	}
+}
+
+func (c VideoProcessorConfig) ffprobePath() string {
+	if isEmpty(c.FFprobe) {
+		return defaultFFprobePath
+	}
+	return c.FFprobe
+}
+
+func probeMedia(ffprobe, path string) (MediaInfo, error) {
+	var err error
+	var out []byte
+	var media MediaInfo
+	cmd := exec.Command(ffprobe, "-v", "error", "-show_streams", "-show_format", "-of", "json", path)
+	if out, err = cmd.Output(); err == nil {
+		var res ffprobeOutput
+		if err = json.Unmarshal(out, &res); err == nil {
+			languages := make([]string, 0, len(res.Streams))
+			for _, stream := range res.Streams {
+				switch stream.CodecType {
+				case "video":
+					if stream.Disposition.AttachedPic == 0 && isEmpty(media.VideoCodec) {
+						media.VideoCodec = stream.CodecName
+						media.Width, media.Height = stream.Width, stream.Height
+						if duration, parseErr := strconv.ParseFloat(stream.Duration, 64); parseErr == nil {
+							media.Duration = duration
+						}
+					}
+				case "audio":
+					if isEmpty(media.AudioCodec) {
+						media.AudioCodec = stream.CodecName
+					}
+					if language := stream.Tags.Language; !isEmpty(language) && language != "und" {
+						languages = append(languages, language)
+					}
+				}
+			}
+			media.AudioLanguages = strings.Join(languages, ",")
+			if duration, parseErr := strconv.ParseFloat(res.Format.Duration, 64); parseErr == nil {
+				media.Duration = duration
+			}
+			if bitrate, parseErr := strconv.ParseUint(res.Format.BitRate, 10, 64); parseErr == nil {
+				media.Bitrate = bitrate
+			}
+		}
+	} else {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			err = &probeError{path: path, stderr: strings.TrimSpace(string(exitErr.Stderr))}
+		} else {
+			err = fmt.Errorf("ffprobe: %v", err)
+		}
+	}
+	if err == nil && !media.IsVideo() {
+		err = errNotMedia
+	}
+	return media, err
+}
+
+type probeError struct {
+	path   string
+	stderr string
+}
+
+func (e *probeError) Error() string {
+	return "unable to probe " + e.path + ": " + e.stderr
+}
+
+func (cr *Observer) probeFile(file TorrentFile, fullPath string) (string, error) {
+	media, err := probeMedia(cr.Processor.ffprobePath(), fullPath)
+	var probeErr *probeError
+	if errors.Is(err, errNotMedia) {
+		logger.Infof("File %s skipped: %v", file.Name, err)
+		return err.Error(), nil
+	} else if errors.As(err, &probeErr) {
+		return "", err
+	} else if err != nil {
+		logger.Warning("Unable to probe", fullPath, err)
+	} else {
+		logger.Debugf("File %s: %s %dx%d %s, %.0f sec", file.Name, media.VideoCodec, media.Width, media.Height,
+			media.AudioCodec, media.Duration)
+		if err = cr.DB.SetFileMedia(file.Id, media); err != nil {
+			logger.Error(err)
+		}
+	}
+	return "", nil
+}
+
+func (cr *Observer) getMediaTemplateData(file TorrentFile) map[string]interface{} {
+	media, err := cr.DB.GetFileMedia(file.Id)
+	if err != nil {
+		logger.Warning(err)
+	}
+	return media.templateData()
+}
@@ -0,0 +1,107 @@
+/*
+ * BSD-3-Clause
+ * Copyright 2020 sot (PR_713, C_rho_272)
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ * 1. Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ * this list of conditions and the following disclaimer in the documentation and/or
+ * other materials provided with the distribution.
+ * 3. Neither the name of the copyright holder nor the names of its contributors
+ * may be used to endorse or promote products derived from this software without
+ * specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+ * IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+ * BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+ * OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+ * WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY
+ * OF SUCH DAMAGE.
+ */
+
+package TtKVC
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	testProbeVideo = `{"streams": [
+		{"codec_type": "video", "codec_name": "h264", "width": 1280, "height": 720, "duration": "10.0"},
+		{"codec_type": "audio", "codec_name": "aac", "tags": {"language": "eng"}},
+		{"codec_type": "audio", "codec_name": "ac3", "tags": {"language": "und"}}
+	], "format": {"duration": "12.5", "bit_rate": "1500000"}}`
+	testProbeAudio = `{"streams": [{"codec_type": "audio", "codec_name": "mp3"}], "format": {"duration": "200"}}`
+)
+
+func writeFFprobe(t *testing.T, dir, output string, code int) string {
+	path := filepath.Join(dir, "ffprobe")
+	script := "#!/bin/sh\ncat <<'EOF'\n" + output + "\nEOF\n"
+	if code != 0 {
+		script = "#!/bin/sh\necho 'Invalid data found when processing input' >&2\nexit 1\n"
+	}
+	if err := ioutil.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestProbeMedia(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ttkvc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	media, err := probeMedia(writeFFprobe(t, dir, testProbeVideo, 0), "video.mkv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := MediaInfo{Duration: 12.5, VideoCodec: "h264", AudioCodec: "aac", Width: 1280, Height: 720,
+		AudioLanguages: "eng", Bitrate: 1500000}
+	if media != expected {
+		t.Error("unexpected media", media)
+	}
+	if _, err = probeMedia(writeFFprobe(t, dir, testProbeAudio, 0), "audio.mp3"); !errors.Is(err, errNotMedia) {
+		t.Error("expected not media error, got", err)
+	}
+	var probeErr *probeError
+	if _, err = probeMedia(writeFFprobe(t, dir, "", 1), "broken.mkv"); !errors.As(err, &probeErr) || errors.Is(err, errNotMedia) {
+		t.Error("expected probe error, got", err)
+	}
+	if _, err = probeMedia(filepath.Join(dir, "missing"), "video.mkv"); err == nil || errors.As(err, &probeErr) {
+		t.Error("expected ffprobe start error, got", err)
+	}
+}
+
+func TestUploadFileProbe(t *testing.T) {
+	cr, closeDB := testObserver(t)
+	defer closeDB()
+	video, _ := testSidecarFiles(t, cr, "Show")
+	dir := filepath.Dir(cr.DB.ConnectionString)
+	cr.Processor.FFprobe = writeFFprobe(t, dir, testProbeAudio, 0)
+	cr.uploadFile(video, filepath.Join(dir, "Episode.mkv"), 1)
+	file, err := cr.DB.GetTorrentFile(video.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Status != FileReadyStatus || file.LastError != errNotMedia.Error() {
+		t.Error("file without video must be skipped with reason", file.Status, file.LastError)
+	}
+	cr.Processor.FFprobe = writeFFprobe(t, dir, "", 1)
+	cr.uploadFile(file, filepath.Join(dir, "Episode.mkv"), 1)
+	if file, err = cr.DB.GetTorrentFile(video.Id); err != nil {
+		t.Fatal(err)
+	}
+	if file.Status != FileErrorStatus || file.Attempts != 1 || isEmpty(file.LastError) {
+		t.Error("file failed to probe must be failed", file.Status, file.Attempts, file.LastError)
+	}
+}
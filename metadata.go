@@ -0,0 +1,123 @@
+/*
+ * BSD-3-Clause
+ * Copyright 2020 sot (PR_713, C_rho_272)
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ * 1. Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ * this list of conditions and the following disclaimer in the documentation and/or
+ * other materials provided with the distribution.
+ * 3. Neither the name of the copyright holder nor the names of its contributors
+ * may be used to endorse or promote products derived from this software without
+ * specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+ * IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+ * BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+ * OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+ * WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY
+ * OF SUCH DAMAGE.
+ */
+
+package TtKVC
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+type MetadataField struct {
+	Name  string `json:"name"`
+	Meta  string `json:"meta"`
+	Multi bool   `json:"multi"`
+}
+
+type MetadataMapping struct {
+	ProfileId int64           `json:"profileid"`
+	Fields    []MetadataField `json:"fields"`
+}
+
+func (m MetadataMapping) isEnabled() bool {
+	return m.ProfileId > 0 && len(m.Fields) > 0
+}
+
+func (m MetadataMapping) buildXML(meta map[string]string) (string, error) {
+	var err error
+	hasValues := false
+	sb := strings.Builder{}
+	sb.WriteString("<metadata>")
+	for _, field := range m.Fields {
+		value := strings.TrimSpace(meta[field.Meta])
+		if isEmpty(value) {
+			continue
+		}
+		values := []string{value}
+		if field.Multi {
+			values = strings.Split(value, ",")
+		}
+		for _, v := range values {
+			if v = strings.TrimSpace(v); isEmpty(v) {
+				continue
+			}
+			hasValues = true
+			sb.WriteString("<" + field.Name + ">")
+			if err = xml.EscapeText(&sb, []byte(v)); err != nil {
+				return "", err
+			}
+			sb.WriteString("</" + field.Name + ">")
+		}
+	}
+	sb.WriteString("</metadata>")
+	if !hasValues {
+		return "", nil
+	}
+	return sb.String(), nil
+}
+
+func isMetaChanged(oldMeta, newMeta map[string]string) bool {
+	for k, v := range newMeta {
+		if oldMeta[k] != v {
+			return true
+		}
+	}
+	return false
+}
+
+func (cr *Observer) setEntryMetadata(torrent int64, entryId string) error {
+	if !cr.Kaltura.Metadata.isEnabled() {
+		return nil
+	}
+	var err error
+	var meta map[string]string
+	if meta, err = cr.DB.GetTorrentMeta(torrent); err == nil {
+		var xmlData string
+		if xmlData, err = cr.Kaltura.Metadata.buildXML(meta); err == nil && !isEmpty(xmlData) {
+			logger.Debug("Setting metadata of entry", entryId)
+			err = cr.Kaltura.SetEntryMetadata(entryId, cr.Kaltura.Metadata.ProfileId, xmlData)
+		}
+	}
+	return err
+}
+
+func (cr *Observer) updateTorrentMetadata(torrent int64) {
+	if !cr.Kaltura.Metadata.isEnabled() {
+		return
+	}
+	files, err := cr.DB.GetTorrentFiles(torrent)
+	if err == nil {
+		for _, file := range files {
+			if !isEmpty(file.EntryId) && file.Status != FilePendingStatus && file.Status != FileDownloadingStatus {
+				if err = cr.setEntryMetadata(torrent, file.EntryId); err != nil {
+					logger.Error(err)
+				}
+			}
+		}
+	} else {
+		logger.Error(err)
+	}
+}
@@ -0,0 +1,99 @@
+/*
+ * BSD-3-Clause
+ * Copyright 2020 sot (PR_713, C_rho_272)
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ * 1. Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ * this list of conditions and the following disclaimer in the documentation and/or
+ * other materials provided with the distribution.
+ * 3. Neither the name of the copyright holder nor the names of its contributors
+ * may be used to endorse or promote products derived from this software without
+ * specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+ * IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+ * BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+ * OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+ * WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY
+ * OF SUCH DAMAGE.
+ */
+
+package TtKVC
+
+import (
+	"testing"
+)
+
+func TestBuildMetadataXML(t *testing.T) {
+	mapping := MetadataMapping{
+		ProfileId: 1,
+		Fields: []MetadataField{
+			{Name: "Title", Meta: "name"},
+			{Name: "Genre", Meta: "genre", Multi: true},
+			{Name: "Year", Meta: "year"},
+		},
+	}
+	tests := []struct {
+		name string
+		meta map[string]string
+		xml  string
+	}{
+		{
+			name: "single",
+			meta: map[string]string{"name": " Show ", "year": "2020", "other": "x"},
+			xml:  "<metadata><Title>Show</Title><Year>2020</Year></metadata>",
+		},
+		{
+			name: "multi",
+			meta: map[string]string{"genre": "Drama, Comedy,, Crime "},
+			xml:  "<metadata><Genre>Drama</Genre><Genre>Comedy</Genre><Genre>Crime</Genre></metadata>",
+		},
+		{
+			name: "single with comma",
+			meta: map[string]string{"name": "Me, Myself & Irene"},
+			xml:  "<metadata><Title>Me, Myself &amp; Irene</Title></metadata>",
+		},
+		{
+			name: "escape",
+			meta: map[string]string{"name": `<b>"Tom" & 'Jerry'</b>`},
+			xml:  "<metadata><Title>&lt;b&gt;&#34;Tom&#34; &amp; &#39;Jerry&#39;&lt;/b&gt;</Title></metadata>",
+		},
+		{
+			name: "empty",
+			meta: map[string]string{"name": " ", "genre": " , ", "other": "x"},
+		},
+		{
+			name: "no meta",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := mapping.buildXML(test.meta)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res != test.xml {
+				t.Errorf("unexpected xml\n got: %s\nwant: %s", res, test.xml)
+			}
+		})
+	}
+}
+
+func TestIsMetaChanged(t *testing.T) {
+	oldMeta := map[string]string{"name": "Show", "year": "2020"}
+	if isMetaChanged(oldMeta, map[string]string{"name": "Show"}) {
+		t.Error("subset of meta must not be changed")
+	}
+	if !isMetaChanged(oldMeta, map[string]string{"name": "Show 2"}) {
+		t.Error("changed value not detected")
+	}
+	if !isMetaChanged(oldMeta, map[string]string{"genre": "Drama"}) {
+		t.Error("new value not detected")
+	}
+}
@@ -0,0 +1,169 @@
+/*
+ * BSD-3-Clause
+ * Copyright 2020 sot (PR_713, C_rho_272)
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ * 1. Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ * this list of conditions and the following disclaimer in the documentation and/or
+ * other materials provided with the distribution.
+ * 3. Neither the name of the copyright holder nor the names of its contributors
+ * may be used to endorse or promote products derived from this software without
+ * specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+ * IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+ * BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+ * OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+ * WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY
+ * OF SUCH DAMAGE.
+ */
+
+package TtKVC
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+const (
+	getSchemaVersion  = "PRAGMA user_version"
+	setSchemaVersion  = "PRAGMA user_version = %d"
+	getForeignKeys    = "PRAGMA foreign_keys"
+	setForeignKeysOff = "PRAGMA foreign_keys = OFF"
+	setForeignKeysOn  = "PRAGMA foreign_keys = ON"
+)
+
+var migrations = []string{
+	`ALTER TABLE tt_torrent_file ADD progress real default 0 not null`,
+	`CREATE TABLE tt_source
+	(
+		id     integer not null
+			primary key autoincrement,
+		name   text    not null
+			unique,
+		offset int default 0 not null
+	);
+	ALTER TABLE tt_torrent ADD source integer references tt_source on delete set null`,
+	`CREATE TABLE tt_feed_item
+	(
+		source integer not null
+			references tt_source
+				on delete cascade,
+		guid   text    not null,
+		primary key (source, guid)
+	)`,
+	`ALTER TABLE tt_torrent ADD magnet text default '' not null`,
+	`CREATE TABLE tt_torrent_new
+	(
+		id     integer not null
+			primary key autoincrement,
+		name   text    not null,
+		hash   text    default '' not null,
+		offset int     default 0 not null,
+		source integer
+			references tt_source
+				on delete set null,
+		magnet text    default '' not null
+	);
+	INSERT INTO tt_torrent_new(id, name, offset, source, magnet) SELECT id, name, offset, source, magnet FROM tt_torrent;
+	DROP TABLE tt_torrent;
+	ALTER TABLE tt_torrent_new RENAME TO tt_torrent;
+	CREATE UNIQUE INDEX tt_torrent_hash_uindex ON tt_torrent (hash) WHERE hash != '';
+	CREATE INDEX tt_torrent_name_index ON tt_torrent (name)`,
+	`ALTER TABLE tt_torrent_file ADD length integer default 0 not null;
+	ALTER TABLE tt_torrent_file ADD hash text default '' not null`,
+	`ALTER TABLE tt_torrent_file ADD attempts integer default 0 not null;
+	ALTER TABLE tt_torrent_file ADD last_error text default '' not null;
+	ALTER TABLE tt_torrent_file ADD next_retry integer default 0 not null`,
+	`ALTER TABLE tt_torrent_file ADD upload_token text default '' not null;
+	ALTER TABLE tt_torrent_file ADD upload_offset integer default 0 not null`,
+	`ALTER TABLE tt_torrent ADD playlist_id text default '' not null`,
+	`CREATE TABLE tt_file_media
+	(
+		file            integer not null
+			primary key
+			references tt_torrent_file
+				on delete cascade,
+		duration        real    default 0 not null,
+		video_codec     text    default '' not null,
+		audio_codec     text    default '' not null,
+		width           integer default 0 not null,
+		height          integer default 0 not null,
+		audio_languages text    default '' not null,
+		bitrate         integer default 0 not null
+	)`,
+	`CREATE TABLE tt_video_part
+	(
+		file     integer not null
+			references tt_torrent_file
+				on delete cascade,
+		part     integer not null,
+		parts    integer not null,
+		size     integer default 0 not null,
+		duration real    default 0 not null,
+		sent     integer default 0 not null,
+		primary key (file, part)
+	)`,
+	`CREATE TABLE tt_tg_message
+	(
+		id      integer not null
+			primary key autoincrement,
+		chat    integer not null,
+		file    integer not null
+			references tt_torrent_file
+				on delete cascade,
+		kind    text    not null,
+		part    integer default 0 not null,
+		caption text    default '' not null,
+		sent    integer default 0 not null
+	)`,
+}
+
+func (db *Database) migrate() error {
+	var err error
+	var conn *sql.Conn
+	ctx := context.Background()
+	if conn, err = db.Connection.Conn(ctx); err == nil {
+		defer conn.Close()
+		var version, foreignKeys int
+		if err = conn.QueryRowContext(ctx, getSchemaVersion).Scan(&version); err == nil && version < len(migrations) {
+			if err = conn.QueryRowContext(ctx, getForeignKeys).Scan(&foreignKeys); err == nil {
+				if _, err = conn.ExecContext(ctx, setForeignKeysOff); err == nil {
+					for ; err == nil && version < len(migrations); version++ {
+						logger.Infof("Migrating database schema to version %d", version+1)
+						err = applyMigration(ctx, conn, version+1, migrations[version])
+					}
+					if foreignKeys != 0 {
+						if _, fkErr := conn.ExecContext(ctx, setForeignKeysOn); fkErr != nil {
+							logger.Error(fkErr)
+						}
+					}
+				}
+			}
+		}
+	}
+	return err
+}
+
+func applyMigration(ctx context.Context, conn *sql.Conn, version int, query string) error {
+	var err error
+	var tx *sql.Tx
+	if tx, err = conn.BeginTx(ctx, nil); err == nil {
+		if _, err = tx.ExecContext(ctx, query); err == nil {
+			_, err = tx.ExecContext(ctx, fmt.Sprintf(setSchemaVersion, version))
+		}
+		if err == nil {
+			err = tx.Commit()
+		} else {
+			_ = tx.Rollback()
+		}
+	}
+	return err
+}
@@ -36,6 +36,7 @@ import (
 	"os"
 	"regexp"
 	"strings"
+	"sync"
 	"text/template"
 )
 
@@ -49,13 +50,26 @@ const (
 	pWatch           = "watch"
 	pAdmin           = "admin"
 	pFilesPending    = "files"
+	pSources         = "sources"
 	pVideoUrl        = "videourl"
 	pIgnore          = "ignorecmd"
 	pMeta            = "meta"
 	pTags            = "tags"
+	pHash            = "hash"
+	pAdded           = "added"
+	pRemoved         = "removed"
+	pChanged         = "changed"
+	pAttempts        = "attempts"
+	pError           = "error"
+	pRetry           = "retrycmd"
+	pMedia           = "media"
+	pPart            = "part"
+	pParts           = "parts"
 	fReplace         = "replace"
 	tCmdSwitchIgnore = "/switchignore"
 	tCmdForceUpload  = "/forceupload"
+	tCmdRetry        = "/retry"
+	tCmdResend       = "/resend"
 )
 
 var logger = logging.MustGetLogger("observer")
@@ -137,3 +151,25 @@ func formatHashTags(commaSeparatedWords string) string {
 	}
 	return sb.String()
 }
+
+func runPool(workers uint, count int, job func(int)) {
+	if workers == 0 {
+		workers = 1
+	}
+	jobs := make(chan int)
+	wg := sync.WaitGroup{}
+	for i := uint(0); i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				job(j)
+			}
+		}()
+	}
+	for i := 0; i < count; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
@@ -27,21 +27,18 @@
 package TtKVC
 
 import (
-	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
-	tr "github.com/hekmon/transmissionrpc"
 	"html"
 	"io/ioutil"
 	"math/rand"
 	"os"
 	"path/filepath"
-	"regexp"
-	"sot-te.ch/HTExtractor"
 	tg "sot-te.ch/MTHelper"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	tmpl "text/template"
 	"time"
@@ -53,24 +50,20 @@ type Observer struct {
 		Level string `json:"level"`
 	} `json:"log"`
 	Crawler struct {
-		BaseURL       string                      `json:"baseurl"`
-		ContextURL    string                      `json:"contexturl"`
-		Delay         uint                        `json:"delay"`
-		Threshold     uint                        `json:"threshold"`
-		ReloadDelay   uint                        `json:"reloaddelay"`
-		IgnoreRegexp  string                      `json:"ignoreregexp"`
-		MetaActions   []HTExtractor.ExtractAction `json:"metaactions"`
-		MetaExtractor *HTExtractor.Extractor      `json:"-"`
+		*Source
+		Delay   uint      `json:"delay"`
+		Sources []*Source `json:"sources"`
 	} `json:"crawler"`
-	Transmission struct {
-		Host       string     `json:"host"`
-		Port       uint16     `json:"port"`
-		Login      string     `json:"login"`
-		Password   string     `json:"password"`
-		Path       string     `json:"path"`
-		Encryption bool       `json:"encryption"`
-		Trackers   []string   `json:"trackers"`
-		Client     *tr.Client `json:"-"`
+	Client struct {
+		TorrentClientConfig
+		Path     string        `json:"path"`
+		Trackers []string      `json:"trackers"`
+		Backend  TorrentClient `json:"-"`
+	} `json:"client"`
+	Transmission *struct {
+		TorrentClientConfig
+		Path     string   `json:"path"`
+		Trackers []string `json:"trackers"`
 	} `json:"transmission"`
 	DB       Database `json:"db"`
 	Telegram struct {
@@ -82,47 +75,100 @@ type Observer struct {
 		OTPSeed   string `json:"otpseed"`
 		Messages  struct {
 			tg.TGMessages
-			State            string `json:"state"`
-			stateTmpl        *tmpl.Template
-			VideoIgnored     string `json:"videoignored"`
-			videoIgnoredTmpl *tmpl.Template
-			VideoForced      string `json:"videoforced"`
-			videoForcedTmpl  *tmpl.Template
-			KUpload          string `json:"kupload"`
-			kuploadTmpl      *tmpl.Template
-			TUpload          string `json:"tupload"`
-			tuploadTmpl      *tmpl.Template
+			State             string `json:"state"`
+			stateTmpl         *tmpl.Template
+			VideoIgnored      string `json:"videoignored"`
+			videoIgnoredTmpl  *tmpl.Template
+			VideoForced       string `json:"videoforced"`
+			videoForcedTmpl   *tmpl.Template
+			KUpload           string `json:"kupload"`
+			kuploadTmpl       *tmpl.Template
+			TUpload           string `json:"tupload"`
+			tuploadTmpl       *tmpl.Template
+			TorrentUpdate     string `json:"torrentupdate"`
+			torrentUpdateTmpl *tmpl.Template
+			GiveUp            string `json:"giveup"`
+			giveUpTmpl        *tmpl.Template
 		} `json:"msg"`
 		Video struct {
-			Upload           bool   `json:"upload"`
-			SequentialUpload bool   `json:"sequential"`
-			TempPath         string `json:"temppath"`
+			Upload           bool            `json:"upload"`
+			SequentialUpload bool            `json:"sequential"`
+			TempPath         string          `json:"temppath"`
+			Flavor           FlavorPolicy    `json:"flavor"`
+			Thumbnail        ThumbnailConfig `json:"thumbnail"`
+			Split            SplitPolicy     `json:"split"`
 		} `json:"video"`
 		Client *tg.Telegram `json:"-"`
 	} `json:"telegram"`
 	Kaltura struct {
 		Kaltura
-		WatchPath     string          `json:"watchpath"`
-		Tags          map[string]bool `json:"tags"`
-		EntryName     string          `json:"entryname"`
-		entryNameTmpl *tmpl.Template
+		WatchPath           string          `json:"watchpath"`
+		Tags                map[string]bool `json:"tags"`
+		EntryName           string          `json:"entryname"`
+		entryNameTmpl       *tmpl.Template
+		Retry               RetryPolicy     `json:"retry"`
+		Workers             uint            `json:"workers"`
+		Delay               uint            `json:"delay"`
+		Metadata            MetadataMapping `json:"metadata"`
+		Categories          []string        `json:"categories"`
+		Playlist            string          `json:"playlist"`
+		AudioFlavorParamsId int64           `json:"audioflavorparamsid"`
+		categoriesTmpl      []*tmpl.Template
+		playlistTmpl        *tmpl.Template
 	} `json:"kaltura"`
-	ignorePattern *regexp.Regexp
+	Processor struct {
+		VideoProcessorConfig
+		Backend VideoProcessor `json:"-"`
+	} `json:"processor"`
+	HTTP struct {
+		Listen   string `json:"listen"`
+		Token    string `json:"token"`
+		Login    string `json:"login"`
+		Password string `json:"password"`
+	} `json:"http"`
+	ingest        *ingestQueue
+	playlistMutex sync.Mutex
 }
 
 func ReadConfig(path string) (*Observer, error) {
 	config := new(Observer)
 	confData, err := ioutil.ReadFile(filepath.Clean(path))
 	if err == nil {
-		err = json.Unmarshal(confData, config)
+		if err = json.Unmarshal(confData, config); err == nil {
+			config.applyLegacyClient()
+			config.applyLegacyCrawler()
+		}
 	}
 	return config, err
 }
 
+func (cr *Observer) applyLegacyClient() {
+	if legacy := cr.Transmission; legacy != nil && isEmpty(cr.Client.Host) {
+		logger.Warning("`transmission` config is deprecated, use `client` instead")
+		cr.Client.TorrentClientConfig = legacy.TorrentClientConfig
+		cr.Client.Type = ClientTransmission
+		cr.Client.Path = legacy.Path
+		cr.Client.Trackers = legacy.Trackers
+	}
+}
+
+func (cr *Observer) applyLegacyCrawler() {
+	if legacy := cr.Crawler.Source; legacy != nil {
+		if len(cr.Crawler.Sources) == 0 {
+			logger.Warning("source settings in `crawler` are deprecated, use `crawler.sources` instead")
+			cr.Crawler.Sources = []*Source{legacy}
+		} else {
+			logger.Warning("source settings in `crawler` are ignored, `crawler.sources` is set")
+		}
+		cr.Crawler.Source = nil
+	}
+}
+
 func (cr *Observer) getState(chat int64) (string, error) {
 	var err error
 	var isMob, isAdmin bool
 	var pending []TorrentFile
+	var sources []SourceState
 	var index uint
 	if isMob, err = cr.DB.GetChatExist(chat); err != nil {
 		return "", err
@@ -130,9 +176,17 @@ func (cr *Observer) getState(chat int64) (string, error) {
 	if isAdmin, err = cr.DB.GetAdminExist(chat); err != nil {
 		return "", err
 	}
-	if index, err = cr.DB.GetCrawlOffset(); err != nil {
+	if sources, err = cr.DB.GetSourcesState(); err != nil {
 		return "", err
 	}
+	sourcesSB := strings.Builder{}
+	for i, val := range sources {
+		if i == 0 {
+			index = val.Offset
+		}
+		sourcesSB.WriteString(val.String())
+		sourcesSB.WriteRune('\n')
+	}
 	pendingSB := strings.Builder{}
 	if strings.Index(cr.Telegram.Messages.State, pFilesPending) >= 0 {
 		if pending, err = cr.DB.GetTorrentFilesNotReady(); err != nil {
@@ -150,6 +204,7 @@ func (cr *Observer) getState(chat int64) (string, error) {
 		pAdmin:        isAdmin,
 		pFilesPending: pendingSB.String(),
 		pIndex:        index,
+		pSources:      sourcesSB.String(),
 		pVersion:      Version,
 	})
 }
@@ -173,6 +228,8 @@ func (cr *Observer) InitTg() error {
 		cr.Telegram.Client = telegram
 		logger.Debug("Telegram bot init complete")
 		_ = cr.Telegram.Client.AddCommand(tCmdForceUpload, cr.cmdCheckTorrent)
+		_ = cr.Telegram.Client.AddCommand(tCmdRetry, cr.cmdRetryFile)
+		_ = cr.Telegram.Client.AddCommand(tCmdResend, cr.cmdResendFile)
 		return cr.Telegram.Client.AddCommand(tCmdSwitchIgnore, cr.cmdSwitchFileReadyStatus)
 	} else {
 		return err
@@ -182,9 +239,7 @@ func (cr *Observer) InitTg() error {
 func (cr *Observer) InitKaltura() error {
 	var err error
 	logger.Debug("Initiating kaltura")
-	if isEmpty(cr.Kaltura.URL) || isEmpty(cr.Kaltura.UserId) || isEmpty(cr.Kaltura.Secret) {
-		err = errors.New("invalid kaltura connection data")
-	} else {
+	if err = cr.Kaltura.checkAuth(); err == nil {
 		err = cr.Kaltura.CreateSession()
 	}
 	logger.Debug("Kaltura init complete, err", err)
@@ -194,41 +249,75 @@ func (cr *Observer) InitKaltura() error {
 			logger.Error(msgErr)
 		}
 	}
+	if msgErr := cr.initCategories(); msgErr != nil {
+		logger.Error(msgErr)
+	}
 	return err
 }
 
-func (cr *Observer) InitTransmission() error {
+func (cr *Observer) InitTorrentClient() error {
 	var err error
-	logger.Debug("Initiating transmission rpc")
-	if !isEmpty(cr.Transmission.Host) && cr.Transmission.Port > 0 {
-		var t *tr.Client
-		if t, err = tr.New(cr.Transmission.Host, cr.Transmission.Login, cr.Transmission.Password, &tr.AdvancedConfig{
-			HTTPS: cr.Transmission.Encryption,
-			Port:  cr.Transmission.Port,
-		}); err == nil {
-			cr.Transmission.Client = t
-		}
-	} else {
-		err = errors.New("invalid transmission connection data")
+	logger.Debug("Initiating torrent client")
+	var backend TorrentClient
+	if backend, err = NewTorrentClient(cr.Client.TorrentClientConfig); err == nil {
+		cr.Client.Backend = backend
 	}
-	logger.Debug("Transmission rpc init complete, err", err)
+	logger.Debug("Torrent client init complete, err", err)
 	return err
 }
 
 func (cr *Observer) InitMetaExtractor() error {
 	var err error
-	if cr.Crawler.MetaExtractor == nil {
-		logger.Debug("Initiating meta extractor")
-		if len(cr.Crawler.MetaActions) == 0 {
-			err = errors.New("extract actions not set")
-		} else {
-			ex := HTExtractor.New()
-			if err = ex.Compile(cr.Crawler.MetaActions); err == nil {
-				cr.Crawler.MetaExtractor = ex
+	sb := strings.Builder{}
+	for _, src := range cr.Crawler.Sources {
+		if err = src.initMetaExtractor(); err != nil {
+			sb.WriteString(err.Error())
+			sb.WriteRune('\n')
+		}
+	}
+	if sb.Len() > 0 {
+		err = errors.New(sb.String())
+	}
+	return err
+}
+
+func (cr *Observer) InitSources() error {
+	var err error
+	logger.Debug("Initiating sources")
+	if len(cr.Crawler.Sources) == 0 {
+		return errors.New("crawler sources not set")
+	}
+	for i, src := range cr.Crawler.Sources {
+		if err = src.init(); err != nil {
+			break
+		}
+		if src.id, err = cr.DB.GetSource(src.Name); err != nil {
+			break
+		}
+		if src.id == TorrentInvalidId {
+			offset := src.Offset
+			if i == 0 && offset == 0 {
+				var count int64
+				if count, err = cr.DB.GetSourcesCount(); err == nil && count == 0 {
+					if offset, err = cr.DB.GetCrawlOffset(); err != nil {
+						logger.Warning("Unable to get legacy crawl offset ", err)
+						offset, err = 0, nil
+					}
+				}
+			}
+			if err == nil {
+				logger.Info("Registering new source", src.Name, "offset", offset)
+				src.id, err = cr.DB.AddSource(src.Name, offset)
 			}
 		}
-		logger.Debug("Meta extractor init complete, err ", err)
+		if err == nil {
+			src.nextOffset, err = cr.DB.GetSourceOffset(src.id)
+		}
+		if err != nil {
+			break
+		}
 	}
+	logger.Debug("Sources init complete, err", err)
 	return err
 }
 
@@ -251,6 +340,16 @@ func (cr *Observer) InitMessages() error {
 		sb.WriteString(err.Error())
 		sb.WriteRune('\n')
 	}
+	if cr.Telegram.Messages.torrentUpdateTmpl, err = tmpl.New("torrentUpdate").Parse(cr.Telegram.Messages.TorrentUpdate); err != nil {
+		sb.WriteString("torrentUpdate: ")
+		sb.WriteString(err.Error())
+		sb.WriteRune('\n')
+	}
+	if cr.Telegram.Messages.giveUpTmpl, err = tmpl.New("giveUp").Parse(cr.Telegram.Messages.GiveUp); err != nil {
+		sb.WriteString("giveUp: ")
+		sb.WriteString(err.Error())
+		sb.WriteRune('\n')
+	}
 	if cr.Telegram.Messages.videoForcedTmpl, err = tmpl.New("videoForced").Parse(cr.Telegram.Messages.VideoForced); err != nil {
 		sb.WriteString("videoForced: ")
 		sb.WriteString(err.Error())
@@ -270,18 +369,21 @@ func (cr *Observer) InitMessages() error {
 
 func (cr *Observer) Init() error {
 	var err error
-	if isEmpty(cr.Crawler.IgnoreRegexp) {
-		cr.ignorePattern = nonEmptyRegexp
-	} else if cr.ignorePattern, err = regexp.Compile(cr.Crawler.IgnoreRegexp); err != nil {
+	if err = cr.DB.Connect(); err != nil {
 		return err
 	}
-	if err = cr.DB.Connect(); err != nil {
+	if err = cr.InitSources(); err != nil {
 		return err
 	}
 	if err = cr.InitTg(); err != nil {
 		return err
 	}
-	if err = cr.InitKaltura(); err != nil {
+	if cr.usesKaltura() {
+		if err = cr.InitKaltura(); err != nil {
+			return err
+		}
+	}
+	if err = cr.InitProcessor(); err != nil {
 		return err
 	}
 	if err = cr.InitMessages(); err != nil {
@@ -292,7 +394,7 @@ func (cr *Observer) Init() error {
 		logger.Error(err)
 		err = nil
 	}
-	if err = cr.InitTransmission(); err != nil {
+	if err = cr.InitTorrentClient(); err != nil {
 		logger.Error(err)
 		err = nil
 	}
@@ -301,48 +403,113 @@ func (cr *Observer) Init() error {
 
 func (cr *Observer) Engage() {
 	defer cr.DB.Close()
-	defer cr.Kaltura.EndSession()
+	if cr.usesKaltura() {
+		defer cr.Kaltura.EndSession()
+	}
 	defer cr.Telegram.Client.Close()
 	var err error
-	var nextOffset uint
-	if nextOffset, err = cr.DB.GetCrawlOffset(); err == nil {
-		go cr.Telegram.Client.HandleUpdates()
-		for {
-			newNextOffset := nextOffset
-			torrents := make([]*Torrent, 0, cr.Crawler.Threshold)
-			for offsetToCheck := nextOffset; offsetToCheck < nextOffset+cr.Crawler.Threshold; offsetToCheck++ {
-				var torrent *Torrent
-				torrent = cr.checkTorrent(offsetToCheck, false)
-				if torrent != nil {
-					newNextOffset = offsetToCheck + 1
-					torrents = append(torrents, torrent)
-				}
-			}
-			if newNextOffset > nextOffset {
-				nextOffset = newNextOffset
-				if err = cr.DB.UpdateCrawlOffset(nextOffset); err != nil {
-					logger.Error(err)
+	go cr.Telegram.Client.HandleUpdates()
+	cr.startIngest()
+	for {
+		for _, src := range cr.Crawler.Sources {
+			var torrents []*Torrent
+			if src.isFeed() {
+				torrents = cr.crawlFeed(src)
+			} else {
+				var newNextOffset uint
+				torrents, newNextOffset = cr.crawl(src, src.nextOffset, src.nextOffset+src.Threshold)
+				if newNextOffset > src.nextOffset {
+					src.nextOffset = newNextOffset
+					if err = cr.DB.UpdateSourceOffset(src.id, src.nextOffset); err != nil {
+						logger.Error(err)
+					}
 				}
 			}
 			if len(torrents) > 0 {
-				go cr.uploadTorrents(torrents)
+				go cr.uploadTorrents(src, torrents)
 			}
-			cr.checkVideo()
-			sleepTime := time.Duration(rand.Intn(int(cr.Crawler.Delay)) + int(cr.Crawler.Delay))
-			logger.Debugf("Sleeping %d sec", sleepTime)
-			time.Sleep(sleepTime * time.Second)
 		}
-	} else {
-		logger.Fatal(err)
+		cr.resolveMagnets()
+		sleepTime := time.Duration(rand.Intn(int(cr.Crawler.Delay)) + int(cr.Crawler.Delay))
+		logger.Debugf("Sleeping %d sec", sleepTime)
+		time.Sleep(sleepTime * time.Second)
 	}
 }
 
-func (cr *Observer) getTorrentMeta(context string) (map[string]string, error) {
+func (cr *Observer) crawl(src *Source, from, to uint) ([]*Torrent, uint) {
+	results := make([]*Torrent, to-from)
+	runPool(src.Workers, len(results), func(i int) {
+		results[i] = cr.checkTorrent(src, from+uint(i), false)
+	})
+	nextOffset := from
+	torrents := make([]*Torrent, 0, len(results))
+	for i, torrent := range results {
+		if torrent != nil {
+			nextOffset = from + uint(i) + 1
+			torrents = append(torrents, torrent)
+		}
+	}
+	return torrents, nextOffset
+}
+
+func (cr *Observer) crawlFeed(src *Source) []*Torrent {
+	var err error
+	var items []FeedItem
+	if items, err = GetFeed(src.FeedURL, src.rateLimiter); err != nil {
+		logger.Error(err)
+		return nil
+	}
+	newItems := make([]FeedItem, 0, len(items))
+	for _, item := range items {
+		var exist bool
+		if exist, err = cr.DB.GetFeedItemExist(src.id, item.GUID); err == nil {
+			if !exist {
+				newItems = append(newItems, item)
+			}
+		} else {
+			logger.Error(err)
+		}
+	}
+	results := make([]*Torrent, len(newItems))
+	runPool(src.Workers, len(newItems), func(i int) {
+		item := newItems[i]
+		logger.Debug("Checking", src.Name, "item", item.GUID)
+		context := item.TorrentURL
+		if strings.HasPrefix(context, magnetPrefix) && !isEmpty(item.Link) {
+			context = item.Link
+		}
+		if !isEmpty(src.BaseURL) && strings.HasPrefix(context, src.BaseURL) {
+			context = strings.TrimPrefix(context, src.BaseURL)
+		}
+		torrent, err := cr.processTorrent(src, item.TorrentURL, context, 0, false)
+		if err == nil {
+			err = cr.DB.AddFeedItem(src.id, item.GUID)
+		}
+		if err == nil {
+			results[i] = torrent
+		} else {
+			logger.Error(err)
+		}
+	})
+	torrents := make([]*Torrent, 0, len(results))
+	for _, torrent := range results {
+		if torrent != nil {
+			torrents = append(torrents, torrent)
+		}
+	}
+	return torrents
+}
+
+func (cr *Observer) getTorrentMeta(src *Source, context string) (map[string]string, error) {
 	var err error
 	var meta map[string]string
-	if cr.Crawler.MetaExtractor != nil {
+	if src.MetaExtractor != nil {
 		var rawMeta map[string][]byte
-		if rawMeta, err = cr.Crawler.MetaExtractor.ExtractData(cr.Crawler.BaseURL, context); err == nil && len(rawMeta) > 0 {
+		src.metaMutex.Lock()
+		src.rateLimiter.Wait(src.BaseURL)
+		rawMeta, err = src.MetaExtractor.ExtractData(src.BaseURL, context)
+		src.metaMutex.Unlock()
+		if err == nil && len(rawMeta) > 0 {
 			meta = make(map[string]string, len(rawMeta))
 			for k, v := range rawMeta {
 				if !isEmpty(k) {
@@ -360,12 +527,16 @@ func (cr *Observer) cmdCheckTorrent(chat int64, _, args string) error {
 	if isAdmin, err = cr.DB.GetAdminExist(chat); err == nil {
 		if isAdmin {
 			var offset uint64
-			if offset, err = strconv.ParseUint(args, 10, 64); err == nil {
-				if torrent := cr.checkTorrent(uint(offset), true); torrent != nil {
-					go cr.uploadTorrents([]*Torrent{torrent})
-				} else {
-					err = errors.New("<nil>")
-				}
+			var srcName string
+			params := strings.Fields(args)
+			if len(params) > 1 {
+				srcName = params[0]
+				params = params[1:]
+			}
+			if len(params) == 0 {
+				err = errors.New("offset not set")
+			} else if offset, err = strconv.ParseUint(params[0], 10, 64); err == nil {
+				err = cr.ForceCheck(srcName, uint(offset))
 			}
 		} else {
 			logger.Infof("ForceUpload unauthorized %d", chat)
@@ -375,48 +546,101 @@ func (cr *Observer) cmdCheckTorrent(chat int64, _, args string) error {
 	return err
 }
 
-func (cr *Observer) checkTorrent(offset uint, force bool) *Torrent {
+func (cr *Observer) ForceCheck(srcName string, offset uint) error {
+	var err error
+	var src *Source
+	if isEmpty(srcName) {
+		src = cr.Crawler.Sources[0]
+	} else {
+		src = cr.getSource(srcName)
+	}
+	if src == nil {
+		err = errors.New("no such source")
+	} else if src.isFeed() {
+		err = errors.New("force upload by offset is not supported for feed source " + src.Name)
+	} else if torrent := cr.checkTorrent(src, offset, true); torrent != nil {
+		go cr.uploadTorrents(src, []*Torrent{torrent})
+	} else {
+		err = errors.New("<nil>")
+	}
+	return err
+}
+
+func (cr *Observer) getSource(name string) *Source {
+	for _, src := range cr.Crawler.Sources {
+		if src.Name == name {
+			return src
+		}
+	}
+	return nil
+}
+
+func (cr *Observer) checkTorrent(src *Source, offset uint, force bool) *Torrent {
+	logger.Debug("Checking", src.Name, "offset", offset)
+	fullContext := fmt.Sprintf(src.ContextURL, offset)
+	torrent, _ := cr.processTorrent(src, src.BaseURL+fullContext, fullContext, offset, force)
+	return torrent
+}
+
+func (cr *Observer) processTorrent(src *Source, torrentUrl, context string, offset uint, force bool) (*Torrent, error) {
 	var err error
 	var torrent *Torrent
-	logger.Debug("Checking offset ", offset)
-	fullContext := fmt.Sprintf(cr.Crawler.ContextURL, offset)
-	if torrent, err = GetTorrent(cr.Crawler.BaseURL+fullContext, cr.Crawler.ReloadDelay); err == nil {
+	if torrent, err = GetTorrent(torrentUrl, src.ReloadDelay, src.rateLimiter, src.Magnets); err == nil {
 		if torrent != nil {
-			logger.Info("New file", torrent.Info.Name)
+			logger.Info("New file", torrent.Info.Name, torrent.InfoHash)
 			size := torrent.FullSize()
 			logger.Info("New torrent size", size)
-			if size > 0 {
+			if size > 0 || torrent.Magnet != nil {
 				var pushTorrent bool
-				if force {
-					pushTorrent = true
-				} else {
-					if id, err := cr.DB.GetTorrent(torrent.Info.Name); err == nil {
-						if id == TorrentInvalidId {
-							pushTorrent = !cr.ignorePattern.MatchString(torrent.Info.Name)
-						} else {
-							pushTorrent = true
-						}
-					} else {
-						logger.Error(err)
+				files := torrentFiles(torrent)
+				var id int64
+				if id, err = cr.DB.GetTorrent(torrent.InfoHash, torrent.Info.Name); err == nil {
+					if id == TorrentInvalidId && torrent.Magnet == nil {
+						id = cr.findPreviousRelease(src, torrent.Info.Name, torrent.InfoHash, files)
 					}
+					pushTorrent = force || id != TorrentInvalidId || !src.ignorePattern.MatchString(torrent.Info.Name)
+				} else {
+					logger.Error(err)
+					pushTorrent = force
 				}
 
 				if pushTorrent {
-					files := torrent.Files()
+					var oldFiles []TorrentFile
 					logger.Debug("Adding torrent", torrent.Info.Name)
-					logger.Debug("Files: ", files)
-					var id int64
-					if id, err = cr.DB.AddTorrent(torrent.Info.Name, offset, files); err == nil {
+					logger.Debug("Files: ", torrent.Files())
+					if id == TorrentInvalidId {
+						id, err = cr.DB.AddTorrent(torrent.Info.Name, torrent.InfoHash, src.id, offset, files)
+					} else {
+						if torrent.Magnet == nil {
+							if oldFiles, err = cr.DB.GetTorrentFiles(id); err != nil {
+								logger.Error(err)
+							}
+						}
+						err = cr.DB.UpdateTorrent(id, torrent.Info.Name, torrent.InfoHash, src.id, offset, files)
+					}
+					if err == nil {
+						if len(oldFiles) > 0 {
+							cr.applyTorrentUpdate(torrent.Info.Name, torrent.InfoHash, oldFiles, files)
+						}
+						if torrent.Magnet != nil {
+							logger.Debug("Torrent is magnet, files will be added after metadata fetched")
+							err = cr.DB.SetTorrentMagnet(id, torrent.Magnet.URI)
+						}
+						var metaErr error
 						var newMeta, existMeta map[string]string
-						if newMeta, err = cr.getTorrentMeta(fullContext); err != nil {
-							logger.Error(err)
+						if newMeta, metaErr = cr.getTorrentMeta(src, context); metaErr != nil {
+							logger.Error(metaErr)
 						}
-						if existMeta, err = cr.DB.GetTorrentMeta(id); err != nil {
-							logger.Error(err)
+						if existMeta, metaErr = cr.DB.GetTorrentMeta(id); metaErr != nil {
+							logger.Error(metaErr)
 						}
 						if len(newMeta) > 0 && len(newMeta) >= len(existMeta) {
 							logger.Debug("Writing newMeta: ", newMeta)
-							err = cr.DB.AddTorrentMeta(id, newMeta)
+							if metaErr = cr.DB.AddTorrentMeta(id, newMeta); metaErr == nil && len(existMeta) > 0 && isMetaChanged(existMeta, newMeta) {
+								go cr.updateTorrentMetadata(id)
+							} else if metaErr != nil {
+								logger.Error(metaErr)
+							}
 						}
 					}
 					if err != nil {
@@ -426,96 +650,150 @@ func (cr *Observer) checkTorrent(offset uint, force bool) *Torrent {
 					logger.Infof("Torrent %s ignored", torrent.Info.Name)
 				}
 			} else {
-				logger.Error("Zero torrent size, offset", offset)
+				logger.Error("Zero torrent size", torrentUrl)
 			}
 		} else {
-			logger.Debugf("%s not a torrent", fullContext)
+			logger.Debugf("%s not a torrent", torrentUrl)
 		}
 	}
-	return torrent
+	return torrent, err
 }
 
-func (cr *Observer) uploadTorrents(newTorrents []*Torrent) {
-	if cr.Transmission.Client != nil {
-		if existingTorrents, err := cr.Transmission.Client.TorrentGet([]string{"id", "name"}, nil); err == nil {
-			if existingTorrents != nil {
-				torrentsToRm := make([]int64, 0, len(newTorrents))
-				for _, existingTorrent := range existingTorrents {
-					if existingTorrent != nil && existingTorrent.Name != nil &&
-						existingTorrent.ID != nil {
-						for _, newTorrent := range newTorrents {
-							if *(existingTorrent.Name) == newTorrent.Info.Name {
-								logger.Debug("Torrent marked as toDelete", *(existingTorrent.Name))
-								torrentsToRm = append(torrentsToRm, *existingTorrent.ID)
-							}
-						}
+func (cr *Observer) uploadTorrents(src *Source, newTorrents []*Torrent) {
+	if cr.Client.Backend != nil {
+		if existingTorrents, err := cr.Client.Backend.GetTorrents(); err == nil {
+			torrentsToRm := make([]string, 0, len(newTorrents))
+			for _, existingTorrent := range existingTorrents {
+				for _, newTorrent := range newTorrents {
+					if existingTorrent.Name == newTorrent.Info.Name ||
+						(!isEmpty(newTorrent.InfoHash) && strings.EqualFold(existingTorrent.Hash, newTorrent.InfoHash)) {
+						logger.Debug("Torrent marked as toDelete", existingTorrent.Name)
+						torrentsToRm = append(torrentsToRm, existingTorrent.Id)
 					}
 				}
-				if len(torrentsToRm) > 0 {
-					if err := cr.Transmission.Client.TorrentRemove(&tr.TorrentRemovePayload{
-						IDs:             torrentsToRm,
-						DeleteLocalData: false,
-					}); err == nil {
-						logger.Debug("Torrents deleted", torrentsToRm)
-					} else {
-						logger.Error(err)
-					}
+			}
+			if len(torrentsToRm) > 0 {
+				if err := cr.Client.Backend.RemoveTorrents(torrentsToRm); err == nil {
+					logger.Debug("Torrents deleted", torrentsToRm)
+				} else {
+					logger.Error(err)
 				}
 			}
 		} else {
 			logger.Error(err)
 		}
-		falsePtr := new(bool)
-		addedTorrents := make([]int64, 0, len(newTorrents))
+		path := src.Path
+		if isEmpty(path) {
+			path = cr.Client.Path
+		}
+		addedTorrents := make([]string, 0, len(newTorrents))
 		for _, newTorrent := range newTorrents {
-			b64 := base64.StdEncoding.EncodeToString(newTorrent.RawData)
-			if addedTorrent, err := cr.Transmission.Client.TorrentAdd(&tr.TorrentAddPayload{
-				DownloadDir: &cr.Transmission.Path,
-				MetaInfo:    &b64,
-				Paused:      falsePtr,
-			}); err == nil {
-				if addedTorrent != nil {
-					addedTorrents = append(addedTorrents, *addedTorrent.ID)
-					logger.Debug("Added torrent", *(addedTorrent.Name))
-				} else {
-					logger.Warning("AddTorrent undefined result", newTorrent.Info.Name)
-				}
+			var addedTorrent ClientTorrent
+			var err error
+			if newTorrent.Magnet == nil {
+				addedTorrent, err = cr.Client.Backend.AddTorrent(newTorrent.RawData, path)
+			} else {
+				addedTorrent, err = cr.Client.Backend.AddMagnet(newTorrent.Magnet.URI, path)
+			}
+			if err == nil {
+				addedTorrents = append(addedTorrents, addedTorrent.Id)
+				logger.Debug("Added torrent", addedTorrent.Name)
 			} else {
 				logger.Error(err)
 			}
 		}
-		if len(addedTorrents) > 0 && len(cr.Transmission.Trackers) > 0 {
-			trackers := tr.TorrentSetPayload{
-				IDs:        addedTorrents,
-				TrackerAdd: cr.Transmission.Trackers,
-			}
-			if err := cr.Transmission.Client.TorrentSet(&trackers); err != nil {
+		if len(addedTorrents) > 0 && len(cr.Client.Trackers) > 0 {
+			if err := cr.Client.Backend.AddTrackers(addedTorrents, cr.Client.Trackers); err != nil {
 				logger.Warning("Unable to append trackers ", err)
 			}
 		}
 	} else {
-		logger.Warning("Transmission client not inited")
+		logger.Warning("Torrent client not inited")
 	}
 }
 
-func (cr *Observer) checkVideo() {
+func (cr *Observer) resolveMagnets() {
 	var err error
-	var session KSessionInfo
-	if session, err = cr.Kaltura.GetSession(); err != nil {
+	var magnets []MagnetTorrent
+	if cr.Client.Backend == nil {
+		return
+	}
+	if magnets, err = cr.DB.GetUnresolvedMagnets(); err == nil && len(magnets) > 0 {
+		var clientTorrents []ClientTorrent
+		if clientTorrents, err = cr.Client.Backend.GetTorrents(); err == nil {
+			byHash := make(map[string]ClientTorrent, len(clientTorrents))
+			for _, ct := range clientTorrents {
+				byHash[strings.ToLower(ct.Hash)] = ct
+			}
+			for _, mt := range magnets {
+				var err error
+				var magnet *Magnet
+				if magnet, err = ParseMagnet(mt.Magnet); err != nil {
+					logger.Error(err)
+					continue
+				}
+				ct, found := byHash[magnet.InfoHash]
+				if !found {
+					logger.Debug("Magnet torrent not found in torrent client", mt.Name)
+					continue
+				}
+				var clientFiles []ClientFile
+				if clientFiles, err = cr.Client.Backend.GetFiles(ct.Id); err != nil || len(clientFiles) == 0 {
+					logger.Debug("Metadata not fetched yet for", mt.Name)
+					continue
+				}
+				logger.Info("Metadata fetched for", mt.Name)
+				if !isEmpty(ct.Name) && ct.Name != mt.Name {
+					if err = cr.DB.SetTorrentName(mt.Id, ct.Name); err != nil {
+						logger.Error(err)
+					}
+				}
+				files := make([]TorrentFile, 0, len(clientFiles))
+				for _, cf := range clientFiles {
+					files = append(files, TorrentFile{
+						Name:   "/" + strings.TrimPrefix(filepath.ToSlash(cf.Name), "/"),
+						Length: uint64(cf.Length),
+					})
+				}
+				logger.Debug("Files: ", files)
+				if err = cr.DB.AddTorrentFiles(mt.Id, files); err != nil {
+					logger.Error(err)
+				}
+			}
+		}
+	}
+	if err != nil {
 		logger.Error(err)
-		err = cr.InitKaltura()
-	} else {
-		logger.Debug("Logged as", session.UserID)
+	}
+}
+
+func (cr *Observer) checkVideo() {
+	var err error
+	if cr.usesKaltura() {
+		var session KSessionInfo
+		if session, err = cr.Kaltura.GetSession(); err != nil {
+			logger.Error(err)
+			err = cr.InitKaltura()
+		} else {
+			logger.Debug("Logged as", session.UserID)
+		}
 	}
 	if err == nil {
 		var files []TorrentFile
 		if files, err = cr.DB.GetTorrentFilesNotReady(); err == nil && files != nil {
+			downloads := &clientDownloads{
+				files:   make(map[int64][]ClientFile),
+				missing: make(map[int64]bool),
+			}
 			for _, file := range files {
 				if !isEmpty(file.Name) {
-					if file.Status == FilePendingStatus {
+					if file.Status == FilePendingStatus || file.Status == FileDownloadingStatus {
+						if cr.ingest.isInFlight(file.Id) || !cr.checkFileDownloaded(file, downloads) {
+							continue
+						}
 						var err error
 						var stat os.FileInfo
-						fullPath := filepath.Join(cr.Kaltura.WatchPath, file.Name)
+						fullPath := filepath.Join(cr.watchPath(file), file.Name)
 						fullPath = filepath.FromSlash(fullPath)
 						stat, err = os.Stat(fullPath)
 						if err != nil {
@@ -525,6 +803,7 @@ func (cr *Observer) checkVideo() {
 								case syscall.EINTR:
 									stat, err = os.Stat(fullPath)
 								case syscall.ENOENT:
+									logger.Debugf("File %s not found in watch path", fullPath)
 									continue
 								default:
 									logger.Error(err)
@@ -535,71 +814,33 @@ func (cr *Observer) checkVideo() {
 							if stat == nil {
 								logger.Warning("Unable to stat file", fullPath)
 							} else {
-								var admins []int64
-								if admins, err = cr.DB.GetAdmins(); err == nil {
-									fName := stat.Name()
-									logger.Debugf("Found ready file %s, size: %d", fName, stat.Size())
-									var entryId string
-									entryName, entryTags := cr.prepareKOptions(file)
-									if entryId, err = cr.Kaltura.CreateMediaEntry(fullPath, entryName, entryTags);
-										err == nil && !isEmpty(entryId) {
-										logger.Debug("Updating file entry id", entryId)
-										if err = cr.DB.SetTorrentFileEntryId(file.Id, entryId); err == nil {
-											logger.Debug("Uploading file", fName)
-											if err = cr.Kaltura.UploadMediaContent(fullPath, entryId); err == nil {
-												var msg string
-												if msg, err = formatMessage(cr.Telegram.Messages.kuploadTmpl,
-													map[string]interface{}{
-														pName:  filepath.Base(file.Name),
-														pId:    entryId,
-														pIndex: file.Id,
-													}); err != nil {
-													msg = err.Error()
-												}
-												cr.Telegram.Client.SendMsg(msg, admins, true)
-												if cr.Telegram.Video.Upload {
-													file.Status = FileReadyStatus
-												} else {
-													file.Status = FileConvertingStatus
-												}
-												err = cr.switchFileReadyStatus(file, admins)
-											}
-										}
-									}
-									if err != nil {
-										logger.Error(err)
-										cr.Telegram.Client.SendMsg(fmt.Sprint(cr.Telegram.Messages.Error, err,
-											" entry id ", entryId,
-											" file ", file.String()),
-											admins, false)
-										err = cr.DB.SetTorrentFileStatus(file.Id, FileErrorStatus)
-									}
+								if cr.ingest.push(file, fullPath, stat.Size()) {
+									logger.Debugf("Found ready file %s, size: %d", stat.Name(), stat.Size())
 								}
 							}
 						}
 						if err != nil {
 							logger.Error(err)
 						}
+					} else if file.Status == FileErrorStatus {
+						cr.retryFailedFile(file)
 					} else if file.Status == FileConvertingStatus {
+						if cr.ingest.isInFlight(file.Id) {
+							continue
+						}
 						var err error
-						if isEmpty(file.EntryId) {
-							err = errors.New("entry id not set for file " + file.String())
-						} else {
-							var entry KMediaEntry
-							if entry, err = cr.Kaltura.GetMediaEntry(file.EntryId); err == nil {
-								if entry.Status == KEntryStatusReady {
-									if cr.checkUploadFile(file) {
-										if err = cr.DB.SetTorrentFileStatus(file.Id, FileReadyStatus); err == nil {
-											var flavors KFlavorAssetSearchResult
-											if flavors, err = cr.Kaltura.GetMediaEntryFlavorAssets(file.EntryId); err == nil {
-												if len(flavors.Objects) == 0 {
-													err = errors.New("flavors for entry " + file.EntryId + " not found")
-												} else {
-													cr.sendTelegramVideo(file, entry, flavors.Objects[0])
-												}
-											}
-										}
-									}
+						var ready bool
+						if ready, err = cr.Processor.Backend.IsReady(file); isPermanentError(err) {
+							cause := err
+							var admins []int64
+							if admins, err = cr.DB.GetAdmins(); err == nil {
+								err = cr.failFile(file, cause, admins)
+							}
+						} else if err == nil && ready && cr.checkUploadFile(file) {
+							if err = cr.DB.SetTorrentFileStatus(file.Id, FileReadyStatus); err == nil {
+								var chats []int64
+								if chats, err = cr.DB.GetChats(); err == nil {
+									cr.sendTelegramVideo(file, chats)
 								}
 							}
 						}
@@ -616,6 +857,153 @@ func (cr *Observer) checkVideo() {
 	}
 }
 
+func (cr *Observer) uploadFile(file TorrentFile, fullPath string, size int64) {
+	var skipReason string
+	var probeErr error
+	if kind := fileKind(file.Name); kind != fileKindVideo {
+		if cr.usesKaltura() {
+			cr.uploadSidecar(file, fullPath, kind)
+			return
+		}
+		logger.Debugf("Sidecar %s skipped by local video processor", file.Name)
+		skipReason = "skipped by local video processor"
+	} else {
+		skipReason, probeErr = cr.probeFile(file, fullPath)
+	}
+	if !isEmpty(skipReason) {
+		if err := cr.DB.SkipTorrentFile(file.Id, skipReason); err != nil {
+			logger.Error(err)
+		}
+		return
+	}
+	var err error
+	var admins []int64
+	if admins, err = cr.DB.GetAdmins(); err == nil && probeErr != nil {
+		logger.Warning(probeErr)
+		err = cr.failFile(file, probeErr, admins)
+	} else if err == nil {
+		fName := filepath.Base(fullPath)
+		logger.Debugf("Processing file %s, size: %d", fName, size)
+		var entryId string
+		if entryId, err = cr.Processor.Backend.Process(file, fullPath, size); err == nil && !isEmpty(entryId) {
+			var msg string
+			if msg, err = formatMessage(cr.Telegram.Messages.kuploadTmpl,
+				map[string]interface{}{
+					pName:  filepath.Base(file.Name),
+					pId:    entryId,
+					pIndex: file.Id,
+					pHash:  file.TorrentHash,
+				}); err != nil {
+				msg = err.Error()
+			}
+			cr.sendFileMsg(file.Id, tgKindNotice, msg, admins, true)
+			if cr.Telegram.Video.Upload {
+				file.Status = FileReadyStatus
+			} else {
+				file.Status = FileConvertingStatus
+			}
+			if err = cr.switchFileReadyStatus(file, admins); err == nil {
+				if plErr := cr.updatePlaylist(file); plErr != nil {
+					logger.Warning(plErr)
+				}
+			}
+		}
+		if err != nil {
+			logger.Error(err)
+			cr.sendFileMsg(file.Id, tgKindNotice, fmt.Sprint(cr.Telegram.Messages.Error, err,
+				" entry id ", entryId,
+				" file ", file.String()),
+				admins, false)
+			err = cr.failFile(file, err, admins)
+		}
+	}
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
+func (cr *Observer) watchPath(file TorrentFile) string {
+	for _, src := range cr.Crawler.Sources {
+		if src.id == file.Source && !isEmpty(src.WatchPath) {
+			return src.WatchPath
+		}
+	}
+	return cr.Kaltura.WatchPath
+}
+
+type clientDownloads struct {
+	torrents map[string]string
+	hashes   map[string]string
+	files    map[int64][]ClientFile
+	missing  map[int64]bool
+}
+
+func (cr *Observer) checkFileDownloaded(file TorrentFile, downloads *clientDownloads) bool {
+	if cr.Client.Backend == nil {
+		return true
+	}
+	if downloads.missing[file.Torrent] {
+		return true
+	}
+	var err error
+	var complete bool
+	clientFiles, cached := downloads.files[file.Torrent]
+	if !cached {
+		if downloads.torrents == nil {
+			downloads.torrents = make(map[string]string)
+			downloads.hashes = make(map[string]string)
+			var torrents []ClientTorrent
+			if torrents, err = cr.Client.Backend.GetTorrents(); err == nil {
+				for _, t := range torrents {
+					downloads.torrents[t.Name] = t.Id
+					downloads.hashes[strings.ToLower(t.Hash)] = t.Id
+				}
+			}
+		}
+		if err == nil {
+			id, found := downloads.hashes[file.TorrentHash]
+			if !found || isEmpty(file.TorrentHash) {
+				var name string
+				if name, err = cr.DB.GetTorrentName(file.Torrent); err == nil {
+					id, found = downloads.torrents[name]
+				}
+			}
+			if err == nil {
+				if found {
+					clientFiles, err = cr.Client.Backend.GetFiles(id)
+				} else {
+					logger.Debugf("Torrent of file %s not found in torrent client, waiting for file in watch path", file.Name)
+					downloads.missing[file.Torrent] = true
+					return true
+				}
+			}
+		}
+		downloads.files[file.Torrent] = clientFiles
+	}
+	if err == nil && clientFiles != nil {
+		var clientFile *ClientFile
+		for i := range clientFiles {
+			if "/"+strings.TrimPrefix(filepath.ToSlash(clientFiles[i].Name), "/") == filepath.ToSlash(file.Name) {
+				clientFile = &clientFiles[i]
+				break
+			}
+		}
+		if clientFile == nil {
+			logger.Debugf("File %s not found in torrent client, waiting for file in watch path", file.Name)
+			complete = true
+		} else if clientFile.Complete() {
+			complete = true
+		} else if file.Status != FileDownloadingStatus || clientFile.Progress != file.Progress {
+			logger.Debugf("File %s downloaded %.1f%%", file.Name, clientFile.Progress*100)
+			err = cr.DB.SetTorrentFileProgress(file.Id, FileDownloadingStatus, clientFile.Progress)
+		}
+	}
+	if err != nil {
+		logger.Warning(err)
+	}
+	return complete
+}
+
 func (cr *Observer) prepareKOptions(torrentFile TorrentFile) (string, []string) {
 	var name string
 	var err error
@@ -644,9 +1032,11 @@ func (cr *Observer) prepareKOptions(torrentFile TorrentFile) (string, []string)
 				}
 				if cr.Kaltura.entryNameTmpl != nil {
 					data := map[string]interface{}{
-						pMeta: meta,
-						pId:   torrentFile.Id,
-						pName: torrentFile.Name,
+						pMeta:  meta,
+						pId:    torrentFile.Id,
+						pName:  torrentFile.Name,
+						pHash:  torrentFile.TorrentHash,
+						pMedia: cr.getMediaTemplateData(torrentFile),
 					}
 					var index int64
 					if index, err = cr.DB.GetTorrentFileIndex(torrentFile.Torrent, torrentFile.Id); err == nil {
@@ -670,14 +1060,7 @@ func (cr *Observer) cmdSwitchFileReadyStatus(chat int64, _, args string) error {
 	if isAdmin, err = cr.DB.GetAdminExist(chat); err == nil {
 		if isAdmin {
 			if id, err = strconv.ParseInt(args, 10, 64); err == nil {
-				var file TorrentFile
-				if file, err = cr.DB.GetTorrentFile(id); err == nil {
-					if isEmpty(file.Name) {
-						err = errors.New("no such entry")
-					} else {
-						err = cr.switchFileReadyStatus(file, []int64{chat})
-					}
-				}
+				err = cr.SwitchFileIgnore(id, []int64{chat})
 			}
 		} else {
 			logger.Infof("SwitchFileReadyStatus unauthorized %d", chat)
@@ -687,6 +1070,19 @@ func (cr *Observer) cmdSwitchFileReadyStatus(chat int64, _, args string) error {
 	return err
 }
 
+func (cr *Observer) SwitchFileIgnore(id int64, chats []int64) error {
+	var err error
+	var file TorrentFile
+	if file, err = cr.DB.GetTorrentFile(id); err == nil {
+		if isEmpty(file.Name) {
+			err = errors.New("no such entry")
+		} else {
+			err = cr.switchFileReadyStatus(file, chats)
+		}
+	}
+	return err
+}
+
 func (cr *Observer) switchFileReadyStatus(file TorrentFile, chats []int64) error {
 	var err error
 	var newFileStatus uint8
@@ -707,56 +1103,108 @@ func (cr *Observer) switchFileReadyStatus(file TorrentFile, chats []int64) error
 			}); err != nil {
 			msg = err.Error()
 		}
-		cr.Telegram.Client.SendMsg(msg, chats, true)
+		cr.sendFileMsg(file.Id, tgKindNotice, msg, chats, true)
 	}
 	return err
 }
 
-func (cr *Observer) sendTelegramVideo(file TorrentFile, entry KMediaEntry, flavor KFlavorAsset) {
+func (cr *Observer) sendTelegramVideo(file TorrentFile, chats []int64) {
 	var err error
 	var meta map[string]string
 	if meta, err = cr.DB.GetTorrentMeta(file.Torrent); err == nil {
-		var chats []int64
-		if chats, err = cr.DB.GetChats(); err == nil {
-			var index int64
-			var msg string
-			if index, err = cr.DB.GetTorrentFileIndex(file.Torrent, file.Id); err != nil {
-				logger.Error(err)
+		var index int64
+		var msg string
+		if index, err = cr.DB.GetTorrentFileIndex(file.Torrent, file.Id); err != nil {
+			logger.Error(err)
+		}
+		var video ProcessedVideo
+		if video, err = cr.Processor.Backend.GetVideo(file); err == nil {
+			if video.Temporary {
+				defer os.Remove(video.Path)
 			}
-			if msg, err = formatMessage(cr.Telegram.Messages.tuploadTmpl, map[string]interface{}{
+			var media MediaInfo
+			if media, err = cr.DB.GetFileMedia(file.Id); err != nil {
+				logger.Warning(err)
+			}
+			if video.Width == 0 || video.Height == 0 {
+				video.Width, video.Height = media.Width, media.Height
+			}
+			if video.Duration == 0 {
+				video.Duration = media.Duration
+			}
+			data := map[string]interface{}{
 				pMeta:     meta,
-				pVideoUrl: entry.DownloadURL,
+				pVideoUrl: video.URL,
 				pIndex:    index,
-				pTags:     formatHashTags(entry.Tags),
-			}); err != nil {
-				msg = err.Error()
+				pTags:     formatHashTags(video.Tags),
+				pHash:     file.TorrentHash,
+				pMedia:    media.templateData(),
+				pPart:     1,
+				pParts:    1,
 			}
-			var tmpVideoFileName string
-			if tmpVideoFileName, err = downloadToDirectory(cr.Telegram.Video.TempPath, entry.DownloadURL, flavor.FileExt);
-				err == nil {
-				defer os.Remove(tmpVideoFileName)
-				var thumb *tg.MediaParams
-				if tmpThumbFileName, err := downloadToDirectory(cr.Telegram.Video.TempPath,
-					FormatThumbnailURL(entry.ThumbnailUrl, flavor.Width, flavor.Height), "jpg");
-					err == nil {
-					defer os.Remove(tmpThumbFileName)
-					thumb = &tg.MediaParams{
-						Path:      tmpThumbFileName,
-						Width:     int32(flavor.Width),
-						Height:    int32(flavor.Width),
-						Streaming: false,
+			var parts []string
+			if !isEmpty(video.Path) {
+				parts = []string{video.Path}
+				if cr.Telegram.Video.Split.Enabled {
+					var stat os.FileInfo
+					if stat, err = os.Stat(video.Path); err == nil && uint64(stat.Size()) > cr.Telegram.Video.Split.maxSize() {
+						var splitDir string
+						if splitDir, parts, err = cr.splitVideo(video.Path, video.Duration, stat.Size()); err == nil {
+							defer os.RemoveAll(splitDir)
+						} else {
+							logger.Error(err)
+							parts = nil
+						}
 					}
-				} else {
-					logger.Error(err)
 				}
-				video := tg.MediaParams{
-					Path:      tmpVideoFileName,
-					Width:     int32(flavor.Width),
-					Height:    int32(flavor.Height),
+			}
+			if len(parts) == 0 {
+				if msg, err = formatMessage(cr.Telegram.Messages.tuploadTmpl, data); err != nil {
+					msg = err.Error()
+				}
+				if !isEmpty(video.URL) && !strings.Contains(msg, video.URL) {
+					msg += "\n" + video.URL
+				}
+				cr.sendFileMsg(file.Id, tgKindLink, msg, chats, true)
+				return
+			}
+			thumb, thumbErr := cr.getThumbnail(video.Id, video.ThumbnailURL, video.Width, video.Height, video.Path)
+			if thumbErr != nil {
+				logger.Error(thumbErr)
+			}
+			for i, part := range parts {
+				duration := video.Duration
+				if len(parts) > 1 {
+					if partMedia, probeErr := probeMedia(cr.Processor.ffprobePath(), part); probeErr == nil {
+						duration = partMedia.Duration
+					} else {
+						duration = video.Duration / float64(len(parts))
+					}
+				}
+				data[pPart], data[pParts] = i+1, len(parts)
+				if msg, err = formatMessage(cr.Telegram.Messages.tuploadTmpl, data); err != nil {
+					msg = err.Error()
+				}
+				var size int64
+				if stat, statErr := os.Stat(part); statErr == nil {
+					size = stat.Size()
+				}
+				if size == 0 {
+					logger.Warningf("Part %d of %s is empty or missing, not sent", i+1, file.Name)
+					continue
+				}
+				if sent := cr.sendFileVideo(file.Id, i+1, tg.MediaParams{
+					Path:      part,
+					Width:     int32(video.Width),
+					Height:    int32(video.Height),
+					Duration:  int32(duration),
 					Streaming: true,
 					Thumbnail: thumb,
+				}, msg, chats); sent > 0 {
+					if err = cr.DB.AddVideoPart(file.Id, i+1, len(parts), size, duration); err != nil {
+						logger.Error(err)
+					}
 				}
-				cr.Telegram.Client.SendVideo(video, msg, chats, true)
 			}
 		}
 	}
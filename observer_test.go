@@ -0,0 +1,204 @@
+/*
+ * BSD-3-Clause
+ * Copyright 2020 sot (PR_713, C_rho_272)
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ * 1. Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ * this list of conditions and the following disclaimer in the documentation and/or
+ * other materials provided with the distribution.
+ * 3. Neither the name of the copyright holder nor the names of its contributors
+ * may be used to endorse or promote products derived from this software without
+ * specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+ * IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+ * BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+ * OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+ * WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY
+ * OF SUCH DAMAGE.
+ */
+
+package TtKVC
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const legacyConfig = `{
+	"crawler": {
+		"baseurl": "http://tracker.local",
+		"contexturl": "/torrent/%d",
+		"threshold": 10,
+		"delay": 10,
+		"reloaddelay": 5,
+		"ignoreregexp": ".*1080p.*",
+		"metaactions": [{"action": "go", "param": "/torrent/all"}]
+	},
+	"transmission": {
+		"host": "localhost",
+		"port": 9091,
+		"login": "user",
+		"password": "secret",
+		"path": "/download",
+		"trackers": ["http://tracker.local/announce"]
+	}
+}`
+
+func writeConfig(t *testing.T, data string) string {
+	dir, err := ioutil.TempDir("", "ttkvc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config.json")
+	if err = ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadLegacyConfig(t *testing.T) {
+	path := writeConfig(t, legacyConfig)
+	defer os.RemoveAll(filepath.Dir(path))
+	cr, err := ReadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cr.Crawler.Delay != 10 {
+		t.Error("unexpected crawler delay", cr.Crawler.Delay)
+	}
+	if len(cr.Crawler.Sources) != 1 {
+		t.Fatal("expected implicit source, got", cr.Crawler.Sources)
+	}
+	src := cr.Crawler.Sources[0]
+	if src.BaseURL != "http://tracker.local" || src.ContextURL != "/torrent/%d" || src.Threshold != 10 ||
+		src.ReloadDelay != 5 || src.IgnoreRegexp != ".*1080p.*" || len(src.MetaActions) != 1 {
+		t.Error("legacy crawler settings not mapped", src.BaseURL, src.ContextURL)
+	}
+	if err = src.init(); err != nil || src.Name != "tracker.local" {
+		t.Error("unable to init legacy source", src.Name, err)
+	}
+	if cr.Client.Type != ClientTransmission || cr.Client.Host != "localhost" || cr.Client.Port != 9091 ||
+		cr.Client.Path != "/download" || len(cr.Client.Trackers) != 1 {
+		t.Error("legacy transmission settings not mapped", cr.Client)
+	}
+}
+
+func TestReadConfigSources(t *testing.T) {
+	path := writeConfig(t, `{
+	"crawler": {
+		"delay": 10,
+		"baseurl": "http://legacy.local",
+		"sources": [{"baseurl": "http://first.local"}, {"type": "feed", "feedurl": "http://second.local/rss"}]
+	},
+	"client": {"type": "deluge", "host": "deluge.local", "port": 8112}
+}`)
+	defer os.RemoveAll(filepath.Dir(path))
+	cr, err := ReadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cr.Crawler.Sources) != 2 || cr.Crawler.Sources[0].BaseURL != "http://first.local" {
+		t.Error("explicit sources must take precedence", cr.Crawler.Sources)
+	}
+	if cr.Client.Type != ClientDeluge || cr.Client.Host != "deluge.local" {
+		t.Error("unexpected client settings", cr.Client)
+	}
+}
+
+type fakeClient struct {
+	torrents []ClientTorrent
+	files    map[string][]ClientFile
+}
+
+func (f *fakeClient) GetTorrents() ([]ClientTorrent, error) {
+	return f.torrents, nil
+}
+
+func (f *fakeClient) RemoveTorrents(ids []string) error {
+	return nil
+}
+
+func (f *fakeClient) AddTorrent(metaInfo []byte, path string) (ClientTorrent, error) {
+	return ClientTorrent{}, nil
+}
+
+func (f *fakeClient) AddMagnet(uri string, path string) (ClientTorrent, error) {
+	return ClientTorrent{}, nil
+}
+
+func (f *fakeClient) AddTrackers(ids []string, trackers []string) error {
+	return nil
+}
+
+func (f *fakeClient) GetProgress(id string) (float64, error) {
+	return 0, nil
+}
+
+func (f *fakeClient) GetFiles(id string) ([]ClientFile, error) {
+	return f.files[id], nil
+}
+
+func TestCheckFileDownloaded(t *testing.T) {
+	cr, closeDB := testObserver(t)
+	defer closeDB()
+	video, sidecar := testSidecarFiles(t, cr, "Show")
+	client := &fakeClient{files: make(map[string][]ClientFile)}
+	cr.Client.Backend = client
+	newDownloads := func() *clientDownloads {
+		return &clientDownloads{
+			files:   make(map[int64][]ClientFile),
+			missing: make(map[int64]bool),
+		}
+	}
+	if !cr.checkFileDownloaded(video, newDownloads()) {
+		t.Error("file of torrent missing in client must be checked in watch path")
+	}
+	client.torrents = []ClientTorrent{{Id: "1", Name: "Show"}}
+	client.files["1"] = []ClientFile{
+		{Name: "Show/Episode.mkv", Progress: 0.5},
+		{Name: "Show/Episode.en.srt", Progress: 1},
+	}
+	downloads := newDownloads()
+	if cr.checkFileDownloaded(video, downloads) {
+		t.Error("partially downloaded file reported as complete")
+	}
+	if !cr.checkFileDownloaded(sidecar, downloads) {
+		t.Error("downloaded file reported as incomplete")
+	}
+	if file, err := cr.DB.GetTorrentFile(video.Id); err != nil {
+		t.Fatal(err)
+	} else if file.Status != FileDownloadingStatus || file.Progress != 0.5 {
+		t.Error("download progress not stored", file.Status, file.Progress)
+	}
+	client.files["1"] = client.files["1"][1:]
+	if !cr.checkFileDownloaded(video, newDownloads()) {
+		t.Error("file missing in client torrent must be checked in watch path")
+	}
+}
+
+func TestWatchPath(t *testing.T) {
+	cr, closeDB := testObserver(t)
+	defer closeDB()
+	video, _ := testSidecarFiles(t, cr, "Show")
+	if video.Source == 0 {
+		t.Fatal("source of torrent file not loaded")
+	}
+	cr.Kaltura.WatchPath = "/watch"
+	cr.Crawler.Sources = []*Source{{id: video.Source + 1, WatchPath: "/other"}}
+	if path := cr.watchPath(video); path != "/watch" {
+		t.Error("expected default watch path, got", path)
+	}
+	cr.Crawler.Sources = append(cr.Crawler.Sources, &Source{id: video.Source, WatchPath: "/watch/show"})
+	if path := cr.watchPath(video); path != "/watch/show" {
+		t.Error("expected source watch path, got", path)
+	}
+}
@@ -0,0 +1,194 @@
+/*
+ * BSD-3-Clause
+ * Copyright 2020 sot (PR_713, C_rho_272)
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ * 1. Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ * this list of conditions and the following disclaimer in the documentation and/or
+ * other materials provided with the distribution.
+ * 3. Neither the name of the copyright holder nor the names of its contributors
+ * may be used to endorse or promote products derived from this software without
+ * specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+ * IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+ * BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+ * OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+ * WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY
+ * OF SUCH DAMAGE.
+ */
+
+package TtKVC
+
+import (
+	"errors"
+	"math"
+	"os"
+	"strings"
+)
+
+const (
+	ProcessorKaltura = "kaltura"
+	ProcessorLocal   = "local"
+)
+
+type VideoProcessor interface {
+	Process(file TorrentFile, fullPath string, size int64) (string, error)
+	IsReady(file TorrentFile) (bool, error)
+	GetVideo(file TorrentFile) (ProcessedVideo, error)
+}
+
+type ProcessedVideo struct {
+	Id           string
+	Path         string
+	URL          string
+	Tags         string
+	ThumbnailURL string
+	Width        uint
+	Height       uint
+	Duration     float64
+	Temporary    bool
+}
+
+type VideoProcessorConfig struct {
+	Type     string                      `json:"type"`
+	Output   string                      `json:"output"`
+	URL      string                      `json:"url"`
+	FFmpeg   string                      `json:"ffmpeg"`
+	FFprobe  string                      `json:"ffprobe"`
+	Profile  string                      `json:"profile"`
+	Profiles map[string]TranscodeProfile `json:"profiles"`
+}
+
+type processError struct {
+	msg       string
+	permanent bool
+}
+
+func (e *processError) Error() string {
+	return e.msg
+}
+
+func (e *processError) IsPermanent() bool {
+	return e.permanent
+}
+
+func isPermanentError(err error) bool {
+	var pErr interface{ IsPermanent() bool }
+	return errors.As(err, &pErr) && pErr.IsPermanent()
+}
+
+func (cr *Observer) usesKaltura() bool {
+	switch strings.ToLower(cr.Processor.Type) {
+	case "", ProcessorKaltura:
+		return true
+	default:
+		return false
+	}
+}
+
+func (cr *Observer) InitProcessor() error {
+	var err error
+	logger.Debug("Initiating video processor")
+	switch strings.ToLower(cr.Processor.Type) {
+	case "", ProcessorKaltura:
+		cr.Processor.Backend = &kalturaProcessor{cr: cr}
+	case ProcessorLocal:
+		cr.Processor.Backend, err = newLocalProcessor(cr.Processor.VideoProcessorConfig, &cr.DB)
+	default:
+		err = errors.New("unsupported video processor type " + cr.Processor.Type)
+	}
+	logger.Debug("Video processor init complete, err", err)
+	return err
+}
+
+type kalturaProcessor struct {
+	cr *Observer
+}
+
+func (p *kalturaProcessor) Process(file TorrentFile, fullPath string, _ int64) (string, error) {
+	var err error
+	cr := p.cr
+	entryId := file.EntryId
+	if isEmpty(entryId) {
+		entryName, entryTags := cr.prepareKOptions(file)
+		if entryId, err = cr.Kaltura.CreateMediaEntry(fullPath, entryName, entryTags); err == nil && !isEmpty(entryId) {
+			logger.Debug("Updating file entry id", entryId)
+			err = cr.DB.SetTorrentFileEntryId(file.Id, entryId)
+		}
+	} else {
+		logger.Debug("Reusing file entry id", entryId)
+	}
+	if err == nil && !isEmpty(entryId) {
+		if err = cr.Kaltura.UploadMediaContent(fullPath, entryId, file.UploadToken, file.UploadedLen,
+			func(token string, offset int64) error {
+				return cr.DB.SetTorrentFileUpload(file.Id, token, offset)
+			}); err == nil {
+			if metaErr := cr.setEntryMetadata(file.Torrent, entryId); metaErr != nil {
+				logger.Warning(metaErr)
+			}
+			if catErr := cr.assignCategories(file, entryId); catErr != nil {
+				logger.Warning(catErr)
+			}
+		}
+	}
+	return entryId, err
+}
+
+func (p *kalturaProcessor) IsReady(file TorrentFile) (bool, error) {
+	if isEmpty(file.EntryId) {
+		return false, errors.New("entry id not set for file " + file.String())
+	}
+	entry, err := p.cr.Kaltura.GetMediaEntry(file.EntryId)
+	return err == nil && entry.Status == KEntryStatusReady, err
+}
+
+func (p *kalturaProcessor) GetVideo(file TorrentFile) (ProcessedVideo, error) {
+	var err error
+	var video ProcessedVideo
+	var entry KMediaEntry
+	if entry, err = p.cr.Kaltura.GetMediaEntry(file.EntryId); err == nil {
+		video = ProcessedVideo{
+			Id:           entry.Id,
+			URL:          entry.DownloadURL,
+			Tags:         entry.Tags,
+			ThumbnailURL: entry.ThumbnailUrl,
+		}
+		var flavors KFlavorAssetSearchResult
+		if flavors, err = p.cr.Kaltura.GetMediaEntryFlavorAssets(file.EntryId); err == nil {
+			policy := p.cr.Telegram.Video.Flavor
+			flavor, found := policy.choose(flavors.Objects)
+			if !found && p.cr.Telegram.Video.Split.Enabled {
+				policy.MaxSize = math.MaxUint64
+				flavor, found = policy.choose(flavors.Objects)
+			}
+			if found {
+				logger.Debugf("Chosen flavor %s %dx%d %s/%s of entry %s", flavor.Id, flavor.Width, flavor.Height,
+					flavor.ContainerFormat, flavor.VideoCodecID, entry.Id)
+				var flavorUrl string
+				if flavorUrl, err = p.cr.Kaltura.GetFlavorURL(flavor.Id); err == nil && !isEmpty(flavorUrl) {
+					video.URL = flavorUrl
+					video.Width, video.Height = flavor.Width, flavor.Height
+					if video.Path, err = downloadToDirectory(p.cr.Telegram.Video.TempPath, flavorUrl, flavor.FileExt); err == nil {
+						video.Temporary = true
+					} else if !isEmpty(video.Path) {
+						os.Remove(video.Path)
+						video.Path = ""
+					}
+				} else {
+					logger.Error("Unable to get url of flavor", flavor.Id, err)
+					err = nil
+				}
+			} else {
+				logger.Warning("No suitable flavor found for entry", entry.Id)
+			}
+		}
+	}
+	return video, err
+}
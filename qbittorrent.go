@@ -0,0 +1,277 @@
+/*
+ * BSD-3-Clause
+ * Copyright 2020 sot (PR_713, C_rho_272)
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ * 1. Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ * this list of conditions and the following disclaimer in the documentation and/or
+ * other materials provided with the distribution.
+ * 3. Neither the name of the copyright holder nor the names of its contributors
+ * may be used to endorse or promote products derived from this software without
+ * specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+ * IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+ * BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+ * OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+ * WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY
+ * OF SUCH DAMAGE.
+ */
+
+package TtKVC
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+)
+
+const (
+	qbAPILogin        = "/api/v2/auth/login"
+	qbAPITorrentsInfo = "/api/v2/torrents/info"
+	qbAPIDelete       = "/api/v2/torrents/delete"
+	qbAPIAdd          = "/api/v2/torrents/add"
+	qbAPIAddTrackers  = "/api/v2/torrents/addTrackers"
+	qbAPIFiles        = "/api/v2/torrents/files"
+	qbFailsResponse   = "Fails."
+)
+
+type qBittorrentClient struct {
+	url      string
+	login    string
+	password string
+	client   *http.Client
+}
+
+type qbTorrent struct {
+	Hash     string  `json:"hash"`
+	Name     string  `json:"name"`
+	Progress float64 `json:"progress"`
+}
+
+func (t qbTorrent) convert() ClientTorrent {
+	return ClientTorrent{
+		Id:       t.Hash,
+		Name:     t.Name,
+		Hash:     t.Hash,
+		Progress: t.Progress,
+	}
+}
+
+type qbFile struct {
+	Name     string  `json:"name"`
+	Size     int64   `json:"size"`
+	Progress float64 `json:"progress"`
+}
+
+func newQBittorrentClient(conf TorrentClientConfig) (TorrentClient, error) {
+	var err error
+	var res *qBittorrentClient
+	var jar *cookiejar.Jar
+	if jar, err = cookiejar.New(nil); err == nil {
+		res = &qBittorrentClient{
+			url:      conf.baseURL(),
+			login:    conf.Login,
+			password: conf.Password,
+			client:   &http.Client{Jar: jar},
+		}
+		err = res.auth()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (q *qBittorrentClient) auth() error {
+	var err error
+	var data []byte
+	if data, err = q.send(qbAPILogin, url.Values{
+		"username": {q.login},
+		"password": {q.password},
+	}); err == nil && strings.TrimSpace(string(data)) == qbFailsResponse {
+		err = errors.New("qbittorrent: authorization failed")
+	}
+	return err
+}
+
+func (q *qBittorrentClient) send(context string, values url.Values) ([]byte, error) {
+	return q.post(context, "application/x-www-form-urlencoded", []byte(values.Encode()))
+}
+
+func (q *qBittorrentClient) post(context, contentType string, body []byte) ([]byte, error) {
+	var err error
+	var data []byte
+	resp, httpErr := q.client.Post(q.url+context, contentType, bytes.NewReader(body))
+	if httpErr == nil && resp != nil && resp.StatusCode == http.StatusForbidden && context != qbAPILogin {
+		_ = resp.Body.Close()
+		if err = q.auth(); err != nil {
+			return nil, err
+		}
+		resp, httpErr = q.client.Post(q.url+context, contentType, bytes.NewReader(body))
+	}
+	if checkResponse(resp, httpErr) {
+		defer resp.Body.Close()
+		data, err = ioutil.ReadAll(resp.Body)
+	} else {
+		if resp != nil {
+			_ = resp.Body.Close()
+		}
+		err = responseError(resp, httpErr)
+	}
+	return data, err
+}
+
+func (q *qBittorrentClient) getTorrents(hashes []string) ([]qbTorrent, error) {
+	var err error
+	var data []byte
+	var res []qbTorrent
+	values := url.Values{}
+	if len(hashes) > 0 {
+		values.Set("hashes", strings.Join(hashes, "|"))
+	}
+	if data, err = q.send(qbAPITorrentsInfo, values); err == nil {
+		err = json.Unmarshal(data, &res)
+	}
+	return res, err
+}
+
+func (q *qBittorrentClient) GetTorrents() ([]ClientTorrent, error) {
+	var err error
+	var res []ClientTorrent
+	var torrents []qbTorrent
+	if torrents, err = q.getTorrents(nil); err == nil {
+		res = make([]ClientTorrent, 0, len(torrents))
+		for _, torrent := range torrents {
+			res = append(res, torrent.convert())
+		}
+	}
+	return res, err
+}
+
+func (q *qBittorrentClient) RemoveTorrents(ids []string) error {
+	var err error
+	if len(ids) > 0 {
+		_, err = q.send(qbAPIDelete, url.Values{
+			"hashes":      {strings.Join(ids, "|")},
+			"deleteFiles": {"false"},
+		})
+	}
+	return err
+}
+
+func (q *qBittorrentClient) AddTorrent(metaInfo []byte, path string) (ClientTorrent, error) {
+	var err error
+	var res ClientTorrent
+	var hash string
+	if hash, err = infoHash(metaInfo); err != nil {
+		return res, err
+	}
+	return q.add(hash, path, func(m *multipart.Writer) error {
+		part, err := m.CreateFormFile("torrents", hash+torrentExt)
+		if err == nil {
+			_, err = part.Write(metaInfo)
+		}
+		return err
+	})
+}
+
+func (q *qBittorrentClient) AddMagnet(uri string, path string) (ClientTorrent, error) {
+	var err error
+	var magnet *Magnet
+	if magnet, err = ParseMagnet(uri); err != nil {
+		return ClientTorrent{}, err
+	}
+	return q.add(magnet.InfoHash, path, func(m *multipart.Writer) error {
+		return m.WriteField("urls", uri)
+	})
+}
+
+func (q *qBittorrentClient) add(hash, path string, writeSource func(*multipart.Writer) error) (ClientTorrent, error) {
+	var err error
+	var res ClientTorrent
+	body := new(bytes.Buffer)
+	m := multipart.NewWriter(body)
+	if err = m.WriteField("savepath", path); err == nil {
+		if err = m.WriteField("paused", "false"); err == nil {
+			if err = writeSource(m); err == nil {
+				err = m.Close()
+			}
+		}
+	}
+	if err == nil {
+		var data []byte
+		if data, err = q.post(qbAPIAdd, m.FormDataContentType(), body.Bytes()); err == nil {
+			if strings.TrimSpace(string(data)) == qbFailsResponse {
+				err = errors.New("qbittorrent: unable to add torrent " + hash)
+			} else {
+				res = ClientTorrent{Id: hash, Hash: hash}
+				var torrents []qbTorrent
+				if torrents, err = q.getTorrents([]string{hash}); err == nil && len(torrents) > 0 {
+					res = torrents[0].convert()
+				}
+			}
+		}
+	}
+	return res, err
+}
+
+func (q *qBittorrentClient) AddTrackers(ids []string, trackers []string) error {
+	var err error
+	urls := strings.Join(trackers, "\n")
+	for _, id := range ids {
+		if _, err = q.send(qbAPIAddTrackers, url.Values{
+			"hash": {id},
+			"urls": {urls},
+		}); err != nil {
+			break
+		}
+	}
+	return err
+}
+
+func (q *qBittorrentClient) GetProgress(id string) (float64, error) {
+	var err error
+	var res float64
+	var torrents []qbTorrent
+	if torrents, err = q.getTorrents([]string{id}); err == nil {
+		if len(torrents) == 0 {
+			err = errors.New("qbittorrent: torrent " + id + " not found")
+		} else {
+			res = torrents[0].Progress
+		}
+	}
+	return res, err
+}
+
+func (q *qBittorrentClient) GetFiles(id string) ([]ClientFile, error) {
+	var err error
+	var data []byte
+	var res []ClientFile
+	if data, err = q.send(qbAPIFiles, url.Values{"hash": {id}}); err == nil {
+		var files []qbFile
+		if err = json.Unmarshal(data, &files); err == nil {
+			res = make([]ClientFile, 0, len(files))
+			for _, file := range files {
+				res = append(res, ClientFile{
+					Name:     file.Name,
+					Length:   file.Size,
+					Progress: file.Progress,
+				})
+			}
+		}
+	}
+	return res, err
+}
@@ -0,0 +1,165 @@
+/*
+ * BSD-3-Clause
+ * Copyright 2020 sot (PR_713, C_rho_272)
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ * 1. Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ * this list of conditions and the following disclaimer in the documentation and/or
+ * other materials provided with the distribution.
+ * 3. Neither the name of the copyright holder nor the names of its contributors
+ * may be used to endorse or promote products derived from this software without
+ * specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+ * IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+ * BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+ * OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+ * WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY
+ * OF SUCH DAMAGE.
+ */
+
+package TtKVC
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+type fakeQBittorrent struct {
+	mutex    sync.Mutex
+	session  string
+	logins   int
+	metaInfo []byte
+	path     string
+	torrents []qbTorrent
+}
+
+func (f *fakeQBittorrent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if r.URL.Path == qbAPILogin {
+		if r.FormValue("username") != "user" || r.FormValue("password") != "secret" {
+			_, _ = w.Write([]byte(qbFailsResponse))
+			return
+		}
+		f.logins++
+		f.session = "sid" + strconv.Itoa(f.logins)
+		http.SetCookie(w, &http.Cookie{Name: "SID", Value: f.session, Path: "/"})
+		_, _ = w.Write([]byte("Ok."))
+		return
+	}
+	if cookie, err := r.Cookie("SID"); err != nil || cookie.Value != f.session {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	switch r.URL.Path {
+	case qbAPIAdd:
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.path = r.FormValue("savepath")
+		if file, _, err := r.FormFile("torrents"); err == nil {
+			f.metaInfo, _ = ioutil.ReadAll(file)
+			_ = file.Close()
+		}
+		_, _ = w.Write([]byte("Ok."))
+	case qbAPITorrentsInfo:
+		res := make([]qbTorrent, 0, len(f.torrents))
+		hashes := r.FormValue("hashes")
+		for _, t := range f.torrents {
+			if hashes == "" || hashes == t.Hash {
+				res = append(res, t)
+			}
+		}
+		_ = json.NewEncoder(w).Encode(res)
+	case qbAPIFiles:
+		_ = json.NewEncoder(w).Encode([]qbFile{{Name: "test.mkv", Size: 1024, Progress: 0.25}})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestQBittorrentClient(t *testing.T) {
+	metaInfo, hash := testMetaInfo(t)
+	fake := &fakeQBittorrent{torrents: []qbTorrent{{Hash: hash, Name: "test.mkv", Progress: 0.25}}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	client, err := NewTorrentClient(testClientConfig(t, server, ClientQBittorrent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	added, err := client.AddTorrent(metaInfo, "/download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added.Id != hash || added.Name != "test.mkv" {
+		t.Error("unexpected added torrent", added)
+	}
+	if !bytes.Equal(fake.metaInfo, metaInfo) || fake.path != "/download" {
+		t.Error("unexpected add payload", fake.path)
+	}
+	torrents, err := client.GetTorrents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(torrents) != 1 || torrents[0].Hash != hash || torrents[0].Progress != 0.25 {
+		t.Error("unexpected torrents", torrents)
+	}
+	files, err := client.GetFiles(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Name != "test.mkv" || files[0].Length != 1024 {
+		t.Error("unexpected files", files)
+	}
+	if fake.logins != 1 {
+		t.Error("expected single login, got", fake.logins)
+	}
+}
+
+func TestQBittorrentClientSessionExpiry(t *testing.T) {
+	_, hash := testMetaInfo(t)
+	fake := &fakeQBittorrent{torrents: []qbTorrent{{Hash: hash, Name: "test.mkv", Progress: 1}}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	client, err := NewTorrentClient(testClientConfig(t, server, ClientQBittorrent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.mutex.Lock()
+	fake.session = "expired"
+	fake.mutex.Unlock()
+	progress, err := client.GetProgress(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress != 1 {
+		t.Error("unexpected progress", progress)
+	}
+	if fake.logins != 2 {
+		t.Error("expected relogin after session expiry, logins:", fake.logins)
+	}
+}
+
+func TestQBittorrentClientAuthFailed(t *testing.T) {
+	server := httptest.NewServer(&fakeQBittorrent{})
+	defer server.Close()
+	conf := testClientConfig(t, server, ClientQBittorrent)
+	conf.Password = "wrong"
+	if client, err := NewTorrentClient(conf); err == nil || client != nil {
+		t.Error("expected authorization error, got", client, err)
+	}
+}
@@ -0,0 +1,115 @@
+/*
+ * BSD-3-Clause
+ * Copyright 2020 sot (PR_713, C_rho_272)
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ * 1. Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ * this list of conditions and the following disclaimer in the documentation and/or
+ * other materials provided with the distribution.
+ * 3. Neither the name of the copyright holder nor the names of its contributors
+ * may be used to endorse or promote products derived from this software without
+ * specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+ * IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+ * BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+ * OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+ * WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY
+ * OF SUCH DAMAGE.
+ */
+
+package TtKVC
+
+import (
+	"net/url"
+	"sync"
+	"time"
+)
+
+type RateLimiter struct {
+	rate  float64
+	burst float64
+	hosts *hostBuckets
+}
+
+type hostBuckets struct {
+	mutex   sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+var sharedHostBuckets = &hostBuckets{buckets: make(map[string]*tokenBucket)}
+
+func NewRateLimiter(rate float64, burst uint) *RateLimiter {
+	if burst == 0 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:  rate,
+		burst: float64(burst),
+		hosts: sharedHostBuckets,
+	}
+}
+
+func (l *RateLimiter) reserve(host string) time.Duration {
+	l.hosts.mutex.Lock()
+	defer l.hosts.mutex.Unlock()
+	now := time.Now()
+	bucket := l.hosts.buckets[host]
+	if bucket == nil {
+		if l.rate <= 0 {
+			return 0
+		}
+		bucket = &tokenBucket{
+			rate:   l.rate,
+			burst:  l.burst,
+			tokens: l.burst,
+			last:   now,
+		}
+		l.hosts.buckets[host] = bucket
+	} else if l.rate > 0 {
+		if l.rate < bucket.rate {
+			bucket.rate = l.rate
+		}
+		if l.burst < bucket.burst {
+			bucket.burst = l.burst
+		}
+	}
+	bucket.tokens += now.Sub(bucket.last).Seconds() * bucket.rate
+	if bucket.tokens > bucket.burst {
+		bucket.tokens = bucket.burst
+	}
+	bucket.last = now
+	bucket.tokens--
+	var wait time.Duration
+	if bucket.tokens < 0 {
+		wait = time.Duration(-bucket.tokens / bucket.rate * float64(time.Second))
+	}
+	return wait
+}
+
+func (l *RateLimiter) Wait(rawUrl string) {
+	if l == nil {
+		return
+	}
+	host := rawUrl
+	if u, err := url.Parse(rawUrl); err == nil && !isEmpty(u.Host) {
+		host = u.Host
+	}
+	if wait := l.reserve(host); wait > 0 {
+		logger.Debugf("Rate limit reached for %s, waiting %s", host, wait)
+		time.Sleep(wait)
+	}
+}
@@ -0,0 +1,53 @@
+/*
+ * BSD-3-Clause
+ * Copyright 2020 sot (PR_713, C_rho_272)
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ * 1. Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ * this list of conditions and the following disclaimer in the documentation and/or
+ * other materials provided with the distribution.
+ * 3. Neither the name of the copyright holder nor the names of its contributors
+ * may be used to endorse or promote products derived from this software without
+ * specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+ * IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+ * BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+ * OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+ * WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY
+ * OF SUCH DAMAGE.
+ */
+
+package TtKVC
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterSharedByHost(t *testing.T) {
+	hosts := &hostBuckets{buckets: make(map[string]*tokenBucket)}
+	first, second, unlimited := NewRateLimiter(1, 1), NewRateLimiter(10, 5), NewRateLimiter(0, 0)
+	first.hosts, second.hosts, unlimited.hosts = hosts, hosts, hosts
+	if wait := unlimited.reserve("tracker.local"); wait != 0 {
+		t.Error("unlimited source must not wait for unknown host", wait)
+	}
+	if wait := first.reserve("tracker.local"); wait != 0 {
+		t.Error("first request must not wait", wait)
+	}
+	if wait := second.reserve("tracker.local"); wait < 900*time.Millisecond {
+		t.Error("second source must share strictest host limit, waited", wait)
+	}
+	if wait := unlimited.reserve("tracker.local"); wait < 1900*time.Millisecond {
+		t.Error("unlimited source must respect limited host, waited", wait)
+	}
+	if wait := second.reserve("other.local"); wait != 0 {
+		t.Error("other host must not be limited", wait)
+	}
+}
@@ -0,0 +1,160 @@
+/*
+ * BSD-3-Clause
+ * Copyright 2020 sot (PR_713, C_rho_272)
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ * 1. Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ * this list of conditions and the following disclaimer in the documentation and/or
+ * other materials provided with the distribution.
+ * 3. Neither the name of the copyright holder nor the names of its contributors
+ * may be used to endorse or promote products derived from this software without
+ * specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+ * IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+ * BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+ * OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+ * WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY
+ * OF SUCH DAMAGE.
+ */
+
+package TtKVC
+
+import (
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRetryAttempts = 5
+	defaultRetryDelay    = 60
+	defaultRetryMaxDelay = 6 * 60 * 60
+)
+
+type RetryPolicy struct {
+	Attempts uint `json:"attempts"`
+	Delay    uint `json:"delay"`
+	MaxDelay uint `json:"maxdelay"`
+}
+
+func (p RetryPolicy) maxAttempts() uint {
+	if p.Attempts == 0 {
+		return defaultRetryAttempts
+	}
+	return p.Attempts
+}
+
+func (p RetryPolicy) isGivenUp(file TorrentFile) bool {
+	return file.Status == FileErrorStatus && file.Attempts >= p.maxAttempts()
+}
+
+func (p RetryPolicy) backoff(attempt uint) time.Duration {
+	delay, maxDelay := p.Delay, p.MaxDelay
+	if delay == 0 {
+		delay = defaultRetryDelay
+	}
+	if maxDelay == 0 {
+		maxDelay = defaultRetryMaxDelay
+	}
+	res := time.Duration(delay) * time.Second
+	for i := uint(1); i < attempt && res < time.Duration(maxDelay)*time.Second; i++ {
+		res *= 2
+	}
+	if res > time.Duration(maxDelay)*time.Second {
+		res = time.Duration(maxDelay) * time.Second
+	}
+	return res
+}
+
+func (cr *Observer) failFile(file TorrentFile, cause error, admins []int64) error {
+	var err error
+	var kErr *KError
+	attempts, storedAttempts := file.Attempts+1, file.Attempts+1
+	if isPermanentError(cause) {
+		logger.Warningf("File %s failed with permanent error %s", file.Name, cause)
+		if storedAttempts < cr.Kaltura.Retry.maxAttempts() {
+			storedAttempts = cr.Kaltura.Retry.maxAttempts()
+		}
+		if errors.As(cause, &kErr) && kErr.Code == KErrEntryNotFound {
+			if err = cr.DB.SetTorrentFileEntryId(file.Id, ""); err == nil {
+				err = cr.DB.SetTorrentFileUpload(file.Id, "", 0)
+			}
+			if err != nil {
+				logger.Error(err)
+			}
+		}
+	}
+	nextRetry := time.Now().Add(cr.Kaltura.Retry.backoff(attempts))
+	if err = cr.DB.SetTorrentFileError(file.Id, storedAttempts, cause.Error(), nextRetry); err == nil {
+		if storedAttempts < cr.Kaltura.Retry.maxAttempts() {
+			logger.Infof("File %s failed %d time(s), next retry at %s", file.Name, attempts, nextRetry.Format(time.RFC3339))
+		} else {
+			logger.Warningf("File %s failed %d time(s), giving up", file.Name, attempts)
+			var msg string
+			if msg, err = formatMessage(cr.Telegram.Messages.giveUpTmpl, map[string]interface{}{
+				pName:     filepath.Base(file.Name),
+				pId:       file.Id,
+				pHash:     file.TorrentHash,
+				pAttempts: attempts,
+				pError:    cause.Error(),
+				pRetry:    tCmdRetry + " " + strconv.FormatInt(file.Id, 10),
+			}); err != nil {
+				msg = err.Error()
+			}
+			cr.sendFileMsg(file.Id, tgKindNotice, msg, admins, true)
+		}
+	}
+	return err
+}
+
+func (cr *Observer) retryFailedFile(file TorrentFile) {
+	if cr.Kaltura.Retry.isGivenUp(file) || time.Now().Unix() < file.NextRetry {
+		return
+	}
+	logger.Infof("Retrying file %s, attempt %d", file.Name, file.Attempts+1)
+	if err := cr.DB.SetTorrentFileStatus(file.Id, FilePendingStatus); err != nil {
+		logger.Error(err)
+	}
+}
+
+func (cr *Observer) RetryFile(id int64) error {
+	var err error
+	var file TorrentFile
+	if file, err = cr.DB.GetTorrentFile(id); err == nil {
+		if isEmpty(file.Name) {
+			err = errors.New("no such entry")
+		} else if file.Status != FileErrorStatus {
+			err = errors.New("file " + file.Name + " is not in error state")
+		} else {
+			logger.Info("Retrying file", file.String())
+			err = cr.DB.RetryTorrentFile(file.Id)
+		}
+	}
+	return err
+}
+
+func (cr *Observer) cmdRetryFile(chat int64, _, args string) error {
+	var err error
+	var id int64
+	var isAdmin bool
+	if isAdmin, err = cr.DB.GetAdminExist(chat); err == nil {
+		if isAdmin {
+			if id, err = strconv.ParseInt(strings.TrimSpace(args), 10, 64); err == nil {
+				err = cr.RetryFile(id)
+			}
+		} else {
+			logger.Infof("RetryFile unauthorized %d", chat)
+			cr.Telegram.Client.SendMsg(cr.Telegram.Messages.Unauthorized, []int64{chat}, false)
+		}
+	}
+	return err
+}
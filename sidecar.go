@@ -0,0 +1,320 @@
+/*
+ * BSD-3-Clause
+ * Copyright 2020 sot (PR_713, C_rho_272)
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ * 1. Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ * this list of conditions and the following disclaimer in the documentation and/or
+ * other materials provided with the distribution.
+ * 3. Neither the name of the copyright holder nor the names of its contributors
+ * may be used to endorse or promote products derived from this software without
+ * specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+ * IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+ * BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+ * OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+ * WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY
+ * OF SUCH DAMAGE.
+ */
+
+package TtKVC
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	fileKindVideo = iota
+	fileKindSubtitle
+	fileKindAudio
+)
+
+var subtitleFormats = map[string]string{
+	".srt":  KCaptionSRT,
+	".ass":  KCaptionSRT,
+	".ssa":  KCaptionSRT,
+	".vtt":  KCaptionWebVTT,
+	".dfxp": KCaptionDFXP,
+	".ttml": KCaptionDFXP,
+}
+
+var audioExtensions = map[string]bool{
+	".mka":  true,
+	".ac3":  true,
+	".eac3": true,
+	".aac":  true,
+	".dts":  true,
+	".flac": true,
+	".mp3":  true,
+	".m4a":  true,
+	".ogg":  true,
+	".opus": true,
+	".wav":  true,
+}
+
+var languageCodes = map[string]string{
+	"en": "English", "eng": "English", "english": "English",
+	"ru": "Russian", "rus": "Russian", "russian": "Russian",
+	"uk": "Ukrainian", "ukr": "Ukrainian", "ukrainian": "Ukrainian",
+	"ja": "Japanese", "jp": "Japanese", "jpn": "Japanese", "japanese": "Japanese",
+	"de": "German", "ger": "German", "deu": "German", "german": "German",
+	"fr": "French", "fre": "French", "fra": "French", "french": "French",
+	"es": "Spanish", "spa": "Spanish", "spanish": "Spanish",
+	"it": "Italian", "ita": "Italian", "italian": "Italian",
+	"pt": "Portuguese", "por": "Portuguese", "portuguese": "Portuguese",
+	"pl": "Polish", "pol": "Polish", "polish": "Polish",
+	"zh": "Chinese", "chi": "Chinese", "zho": "Chinese", "chinese": "Chinese",
+	"ko": "Korean", "kor": "Korean", "korean": "Korean",
+}
+
+var assOverrideRegexp = regexp.MustCompile(`\{[^}]*\}`)
+
+func fileKind(name string) int {
+	ext := strings.ToLower(filepath.Ext(name))
+	if _, ok := subtitleFormats[ext]; ok {
+		return fileKindSubtitle
+	}
+	if audioExtensions[ext] {
+		return fileKindAudio
+	}
+	return fileKindVideo
+}
+
+func baseNameNoExt(name string) string {
+	base := filepath.Base(name)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+func matchSidecar(sidecar TorrentFile, files []TorrentFile) (TorrentFile, string, bool) {
+	base := baseNameNoExt(sidecar.Name)
+	best, bestLen := -1, 0
+	for i, f := range files {
+		if fileKind(f.Name) != fileKindVideo {
+			continue
+		}
+		videoBase := baseNameNoExt(f.Name)
+		l := len(videoBase)
+		if l > bestLen && len(base) >= l && strings.EqualFold(base[:l], videoBase) &&
+			(len(base) == l || strings.ContainsRune(" ._-[(", rune(base[l]))) {
+			best, bestLen = i, l
+		}
+	}
+	if best < 0 {
+		return TorrentFile{}, "", false
+	}
+	return files[best], strings.Trim(base[bestLen:], " ._-[]()"), true
+}
+
+func detectLanguage(text string, isDelimiter func(rune) bool) string {
+	for _, token := range strings.FieldsFunc(text, isDelimiter) {
+		if language, ok := languageCodes[strings.ToLower(token)]; ok {
+			return language
+		}
+	}
+	return ""
+}
+
+func isNotLetter(r rune) bool {
+	return !unicode.IsLetter(r)
+}
+
+func isDotOrUnderscore(r rune) bool {
+	return r == '.' || r == '_'
+}
+
+func sidecarLanguage(name, suffix string) string {
+	language := detectLanguage(suffix, isNotLetter)
+	if isEmpty(language) {
+		language = detectLanguage(filepath.Base(filepath.Dir(name)), isDotOrUnderscore)
+	}
+	return language
+}
+
+func parseASSTime(s string) (int64, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("invalid time %s", s)
+	}
+	h, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	m, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	sec, err := strconv.ParseFloat(parts[2], 64)
+	if err != nil {
+		return 0, err
+	}
+	return h*3600000 + m*60000 + int64(sec*1000+0.5), nil
+}
+
+func formatSRTTime(ms int64) string {
+	return fmt.Sprintf("%02d:%02d:%02d,%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+type srtCue struct {
+	start, end int64
+	text       string
+}
+
+func convertASSToSRT(data []byte) []byte {
+	var cues []srtCue
+	inEvents := false
+	format := []string{"layer", "start", "end", "style", "name", "marginl", "marginr", "marginv", "effect", "text"}
+	scanner := bufio.NewScanner(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			inEvents = strings.EqualFold(line, "[Events]")
+			continue
+		}
+		if !inEvents {
+			continue
+		}
+		if strings.HasPrefix(line, "Format:") {
+			format = format[:0]
+			for _, f := range strings.Split(strings.TrimPrefix(line, "Format:"), ",") {
+				format = append(format, strings.ToLower(strings.TrimSpace(f)))
+			}
+		} else if strings.HasPrefix(line, "Dialogue:") {
+			values := strings.SplitN(strings.TrimPrefix(line, "Dialogue:"), ",", len(format))
+			if len(values) != len(format) {
+				continue
+			}
+			cue := srtCue{}
+			var err error
+			for i, f := range format {
+				switch f {
+				case "start":
+					cue.start, err = parseASSTime(values[i])
+				case "end":
+					cue.end, err = parseASSTime(values[i])
+				case "text":
+					text := assOverrideRegexp.ReplaceAllString(values[i], "")
+					text = strings.NewReplacer(`\N`, "\n", `\n`, "\n", `\h`, " ").Replace(text)
+					cue.text = strings.TrimSpace(text)
+				}
+				if err != nil {
+					break
+				}
+			}
+			if err == nil && !isEmpty(cue.text) {
+				cues = append(cues, cue)
+			}
+		}
+	}
+	sort.SliceStable(cues, func(i, j int) bool {
+		return cues[i].start < cues[j].start
+	})
+	buf := bytes.Buffer{}
+	for i, cue := range cues {
+		buf.WriteString(strconv.Itoa(i + 1))
+		buf.WriteString("\n")
+		buf.WriteString(formatSRTTime(cue.start) + " --> " + formatSRTTime(cue.end))
+		buf.WriteString("\n")
+		buf.WriteString(cue.text)
+		buf.WriteString("\n\n")
+	}
+	return buf.Bytes()
+}
+
+func (cr *Observer) uploadCaption(entryId, fullPath, language, label string) error {
+	ext := strings.ToLower(filepath.Ext(fullPath))
+	if ext == ".ass" || ext == ".ssa" {
+		data, err := ioutil.ReadFile(filepath.Clean(fullPath))
+		if err != nil {
+			return err
+		}
+		var tmpFile *os.File
+		if tmpFile, err = ioutil.TempFile("", "*"+baseNameNoExt(fullPath)+".srt"); err != nil {
+			return err
+		}
+		defer os.Remove(tmpFile.Name())
+		_, err = tmpFile.Write(convertASSToSRT(data))
+		if closeErr := tmpFile.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+		fullPath = tmpFile.Name()
+	}
+	return cr.Kaltura.AddCaption(entryId, fullPath, subtitleFormats[ext], language, label)
+}
+
+func (cr *Observer) uploadSidecar(file TorrentFile, fullPath string, kind int) {
+	var err error
+	var files []TorrentFile
+	if files, err = cr.DB.GetTorrentFiles(file.Torrent); err == nil {
+		video, suffix, found := matchSidecar(file, files)
+		if !found {
+			logger.Infof("Video for %s not found, skipping", file.Name)
+			err = cr.DB.SetTorrentFileStatus(file.Id, FileReadyStatus)
+		} else if video.Status == FileReadyStatus && isEmpty(video.EntryId) {
+			logger.Infof("Video %s skipped, skipping %s", video.Name, file.Name)
+			err = cr.DB.SetTorrentFileStatus(file.Id, FileReadyStatus)
+		} else if cr.Kaltura.Retry.isGivenUp(video) {
+			logger.Warningf("Video %s failed, giving up %s", video.Name, file.Name)
+			err = cr.DB.SetTorrentFileError(file.Id, cr.Kaltura.Retry.maxAttempts(),
+				"video "+filepath.Base(video.Name)+" failed: "+video.LastError, time.Now())
+		} else if isEmpty(video.EntryId) || (video.Status != FileConvertingStatus && video.Status != FileReadyStatus) {
+			logger.Debugf("Waiting for entry of %s to upload %s", video.Name, file.Name)
+		} else {
+			language := sidecarLanguage(file.Name, suffix)
+			label := suffix
+			if isEmpty(label) {
+				label = language
+			}
+			var uploadErr error
+			switch kind {
+			case fileKindSubtitle:
+				logger.Debugf("Uploading caption %s to entry %s", file.Name, video.EntryId)
+				uploadErr = cr.uploadCaption(video.EntryId, fullPath, language, label)
+			case fileKindAudio:
+				if cr.Kaltura.AudioFlavorParamsId == 0 {
+					logger.Warningf("Audio flavor params not set, %s skipped", file.Name)
+				} else {
+					logger.Debugf("Uploading audio %s to entry %s", file.Name, video.EntryId)
+					uploadErr = cr.Kaltura.AddAudio(video.EntryId, fullPath, cr.Kaltura.AudioFlavorParamsId, language, label,
+						file.UploadToken, file.UploadedLen, func(token string, offset int64) error {
+							return cr.DB.SetTorrentFileUpload(file.Id, token, offset)
+						})
+				}
+			}
+			if uploadErr == nil {
+				if err = cr.DB.SetTorrentFileEntryId(file.Id, video.EntryId); err == nil {
+					err = cr.DB.SetTorrentFileStatus(file.Id, FileReadyStatus)
+				}
+			} else {
+				logger.Error(uploadErr)
+				var admins []int64
+				if admins, err = cr.DB.GetAdmins(); err == nil {
+					err = cr.failFile(file, uploadErr, admins)
+				}
+			}
+		}
+	}
+	if err != nil {
+		logger.Error(err)
+	}
+}
@@ -0,0 +1,132 @@
+/*
+ * BSD-3-Clause
+ * Copyright 2020 sot (PR_713, C_rho_272)
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ * 1. Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ * this list of conditions and the following disclaimer in the documentation and/or
+ * other materials provided with the distribution.
+ * 3. Neither the name of the copyright holder nor the names of its contributors
+ * may be used to endorse or promote products derived from this software without
+ * specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+ * IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+ * BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+ * OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+ * WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY
+ * OF SUCH DAMAGE.
+ */
+
+package TtKVC
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func testObserver(t *testing.T) (*Observer, func()) {
+	dir, err := ioutil.TempDir("", "ttkvc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cr := new(Observer)
+	cr.DB.ConnectionString = copyExampleDB(t, dir)
+	if err = cr.DB.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	return cr, func() {
+		cr.DB.Close()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func testSidecarFiles(t *testing.T, cr *Observer, name string) (TorrentFile, TorrentFile) {
+	source, err := cr.DB.AddSource(name, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := cr.DB.AddTorrent(name, "", source, 0, []TorrentFile{
+		{Name: "/" + name + "/Episode.mkv"},
+		{Name: "/" + name + "/Episode.en.srt"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := cr.DB.GetTorrentFiles(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatal("unexpected files", files)
+	}
+	video, sidecar := files[0], files[1]
+	if fileKind(video.Name) != fileKindVideo {
+		video, sidecar = sidecar, video
+	}
+	return video, sidecar
+}
+
+func TestUploadSidecarVideoState(t *testing.T) {
+	cr, closeDB := testObserver(t)
+	defer closeDB()
+
+	video, sidecar := testSidecarFiles(t, cr, "skipped")
+	if err := cr.DB.SetTorrentFileStatus(video.Id, FileReadyStatus); err != nil {
+		t.Fatal(err)
+	}
+	cr.uploadSidecar(sidecar, "", fileKindSubtitle)
+	if file, err := cr.DB.GetTorrentFile(sidecar.Id); err != nil || file.Status != FileReadyStatus {
+		t.Error("sidecar of skipped video must be skipped", file.Status, err)
+	}
+
+	video, sidecar = testSidecarFiles(t, cr, "retrying")
+	if err := cr.DB.SetTorrentFileError(video.Id, 1, "failed", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	cr.uploadSidecar(sidecar, "", fileKindSubtitle)
+	if file, err := cr.DB.GetTorrentFile(sidecar.Id); err != nil || file.Status != FilePendingStatus {
+		t.Error("sidecar must wait for retrying video", file.Status, err)
+	}
+
+	video, sidecar = testSidecarFiles(t, cr, "failed")
+	if err := cr.DB.SetTorrentFileError(video.Id, cr.Kaltura.Retry.maxAttempts(), "failed", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	cr.uploadSidecar(sidecar, "", fileKindSubtitle)
+	if file, err := cr.DB.GetTorrentFile(sidecar.Id); err != nil || !cr.Kaltura.Retry.isGivenUp(file) {
+		t.Error("sidecar of given up video must be given up", file.Status, file.Attempts, err)
+	}
+}
+
+func TestSidecarLanguage(t *testing.T) {
+	tests := []struct {
+		name     string
+		suffix   string
+		language string
+	}{
+		{name: "/Show/Show - 01.rus.ass", suffix: "rus", language: "Russian"},
+		{name: "/Show/Show - 01 [ENG] Forced.srt", suffix: "[ENG] Forced", language: "English"},
+		{name: "/Show/Show - 01.en_US.srt", suffix: "en_US", language: "English"},
+		{name: "/Show/RUS/Show - 01.mka", language: "Russian"},
+		{name: "/Show/Sound_UKR/Show - 01.mka", language: "Ukrainian"},
+		{name: "/Show/Subs.Japanese/Show - 01.ass", language: "Japanese"},
+		{name: "/Show/Show - 01.ass", language: ""},
+		{name: "/The It Crowd/The It Crowd - 01.srt", language: ""},
+		{name: "/De Niro Collection/Heat.srt", language: ""},
+		{name: "/It Crowd/It Crowd - 01.eng.srt", suffix: "eng", language: "English"},
+	}
+	for _, test := range tests {
+		if language := sidecarLanguage(test.name, test.suffix); language != test.language {
+			t.Errorf("language of %s = %q, want %q", test.name, language, test.language)
+		}
+	}
+}
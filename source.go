@@ -0,0 +1,120 @@
+/*
+ * BSD-3-Clause
+ * Copyright 2020 sot (PR_713, C_rho_272)
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ * 1. Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ * this list of conditions and the following disclaimer in the documentation and/or
+ * other materials provided with the distribution.
+ * 3. Neither the name of the copyright holder nor the names of its contributors
+ * may be used to endorse or promote products derived from this software without
+ * specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+ * IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+ * BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+ * OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+ * WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY
+ * OF SUCH DAMAGE.
+ */
+
+package TtKVC
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"sot-te.ch/HTExtractor"
+	"sync"
+)
+
+const (
+	SourceEnum = "enum"
+	SourceFeed = "feed"
+)
+
+type Source struct {
+	Name          string                      `json:"name"`
+	Type          string                      `json:"type"`
+	FeedURL       string                      `json:"feedurl"`
+	BaseURL       string                      `json:"baseurl"`
+	ContextURL    string                      `json:"contexturl"`
+	Offset        uint                        `json:"offset"`
+	Threshold     uint                        `json:"threshold"`
+	ReloadDelay   uint                        `json:"reloaddelay"`
+	Workers       uint                        `json:"workers"`
+	RateLimit     float64                     `json:"ratelimit"`
+	RateBurst     uint                        `json:"rateburst"`
+	IgnoreRegexp  string                      `json:"ignoreregexp"`
+	MetaActions   []HTExtractor.ExtractAction `json:"metaactions"`
+	Path          string                      `json:"path"`
+	WatchPath     string                      `json:"watchpath"`
+	Magnets       bool                        `json:"magnets"`
+	MetaExtractor *HTExtractor.Extractor      `json:"-"`
+	id            int64
+	nextOffset    uint
+	ignorePattern *regexp.Regexp
+	rateLimiter   *RateLimiter
+	metaMutex     sync.Mutex
+}
+
+func (src *Source) init() error {
+	var err error
+	var nameURL string
+	switch src.Type {
+	case "", SourceEnum:
+		src.Type = SourceEnum
+		if isEmpty(src.BaseURL) {
+			return errors.New("source base url not set")
+		}
+		nameURL = src.BaseURL
+	case SourceFeed:
+		if isEmpty(src.FeedURL) {
+			return errors.New("source feed url not set")
+		}
+		nameURL = src.FeedURL
+	default:
+		return errors.New("unsupported source type " + src.Type)
+	}
+	if isEmpty(src.Name) {
+		if u, urlErr := url.Parse(nameURL); urlErr == nil && !isEmpty(u.Host) {
+			src.Name = u.Host
+		} else {
+			src.Name = nameURL
+		}
+	}
+	if isEmpty(src.IgnoreRegexp) {
+		src.ignorePattern = nonEmptyRegexp
+	} else if src.ignorePattern, err = regexp.Compile(src.IgnoreRegexp); err != nil {
+		return err
+	}
+	src.rateLimiter = NewRateLimiter(src.RateLimit, src.RateBurst)
+	return err
+}
+
+func (src *Source) initMetaExtractor() error {
+	var err error
+	if src.MetaExtractor == nil {
+		logger.Debug("Initiating meta extractor for", src.Name)
+		if len(src.MetaActions) == 0 {
+			err = errors.New("extract actions not set for " + src.Name)
+		} else {
+			ex := HTExtractor.New()
+			if err = ex.Compile(src.MetaActions); err == nil {
+				src.MetaExtractor = ex
+			}
+		}
+		logger.Debug("Meta extractor init complete, err ", err)
+	}
+	return err
+}
+
+func (src *Source) isFeed() bool {
+	return src.Type == SourceFeed
+}
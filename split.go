@@ -0,0 +1,132 @@
+/*
+ * BSD-3-Clause
+ * Copyright 2020 sot (PR_713, C_rho_272)
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ * 1. Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ * this list of conditions and the following disclaimer in the documentation and/or
+ * other materials provided with the distribution.
+ * 3. Neither the name of the copyright holder nor the names of its contributors
+ * may be used to endorse or promote products derived from this software without
+ * specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+ * IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+ * BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+ * OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+ * WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY
+ * OF SUCH DAMAGE.
+ */
+
+package TtKVC
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	splitAttempts      = 3
+	splitPartPrefix    = "part"
+	splitMinPartsCount = 2
+)
+
+type SplitPolicy struct {
+	Enabled bool   `json:"enabled"`
+	MaxSize uint64 `json:"maxsize"`
+}
+
+func (p SplitPolicy) maxSize() uint64 {
+	if p.MaxSize == 0 {
+		return defaultFlavorMaxSize
+	}
+	return p.MaxSize
+}
+
+func (c VideoProcessorConfig) ffmpegPath() string {
+	if isEmpty(c.FFmpeg) {
+		return defaultFFmpegPath
+	}
+	return c.FFmpeg
+}
+
+func splitArgs(input, dir string, segmentTime float64) []string {
+	ext := strings.ToLower(filepath.Ext(input))
+	args := []string{"-hide_banner", "-nostdin", "-loglevel", "error", "-i", input,
+		"-map", "0:v:0", "-map", "0:a?", "-c", "copy",
+		"-f", "segment", "-segment_time", fmt.Sprintf("%.3f", segmentTime), "-reset_timestamps", "1"}
+	if ext == ".mp4" || ext == ".m4v" || ext == ".mov" {
+		args = append(args, "-segment_format_options", "movflags=+faststart")
+	}
+	return append(args, filepath.Join(dir, splitPartPrefix+"%03d"+ext))
+}
+
+func (cr *Observer) splitVideo(path string, duration float64, size int64) (string, []string, error) {
+	maxSize := cr.Telegram.Video.Split.maxSize()
+	if duration <= 0 {
+		if media, err := probeMedia(cr.Processor.ffprobePath(), path); err == nil {
+			duration = media.Duration
+		}
+		if duration <= 0 {
+			return "", nil, errors.New("unable to split " + path + ": unknown duration")
+		}
+	}
+	count := int(math.Ceil(float64(size) / float64(maxSize)))
+	if count < splitMinPartsCount {
+		count = splitMinPartsCount
+	}
+	var err error
+	for attempt := 0; attempt < splitAttempts; attempt++ {
+		var dir string
+		if dir, err = ioutil.TempDir(cr.Telegram.Video.TempPath, "split"); err != nil {
+			break
+		}
+		logger.Debugf("Splitting %s to %d parts", path, count)
+		var out []byte
+		cmd := exec.Command(cr.Processor.ffmpegPath(), splitArgs(path, dir, duration/float64(count))...)
+		if out, err = cmd.CombinedOutput(); err == nil {
+			var parts []string
+			if parts, err = filepath.Glob(filepath.Join(dir, splitPartPrefix+"*")); err == nil {
+				sort.Strings(parts)
+				fits := len(parts) > 0
+				var largest int64
+				for _, part := range parts {
+					if stat, statErr := os.Stat(part); statErr != nil {
+						err = statErr
+						break
+					} else if uint64(stat.Size()) > maxSize {
+						fits = false
+						if stat.Size() > largest {
+							largest = stat.Size()
+						}
+					}
+				}
+				if err == nil && fits {
+					return dir, parts, nil
+				}
+				if err == nil {
+					err = fmt.Errorf("part of %s is %d bytes, more than %d", path, largest, maxSize)
+					count = int(math.Ceil(float64(count) * float64(largest) / float64(maxSize)))
+				}
+			}
+		} else {
+			err = fmt.Errorf("ffmpeg: %v %s", err, strings.TrimSpace(string(out)))
+		}
+		os.RemoveAll(dir)
+		logger.Warning(err)
+	}
+	return "", nil, err
+}
@@ -0,0 +1,40 @@
+CREATE TABLE tt_config(
+	name text not null primary key,
+	value text
+);
+CREATE TABLE IF NOT EXISTS "tt_chat" (
+	id INTEGER NOT NULL primary key
+);
+CREATE TABLE tt_torrent
+(
+    id   integer not null
+        primary key autoincrement,
+    name text   not null
+        unique
+, offset int default 0 not null);
+CREATE TABLE tt_torrent_meta
+(
+    torrent integer not null
+        references tt_torrent
+            on delete cascade,
+    name    text    not null,
+    value   text not null,
+    primary key (torrent, name)
+);
+CREATE TABLE tt_admin
+(
+    id INTEGER not null
+        primary key
+);
+CREATE TABLE tt_torrent_file
+(
+    id       integer not null
+        primary key autoincrement,
+    torrent  integer not null
+        references tt_torrent
+            on delete cascade,
+    name     text    not null,
+    ready    integer(1) default 0 not null,
+    entry_id text       default '' not null,
+    unique (torrent, name)
+);
@@ -0,0 +1,113 @@
+/*
+ * BSD-3-Clause
+ * Copyright 2020 sot (PR_713, C_rho_272)
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ * 1. Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ * this list of conditions and the following disclaimer in the documentation and/or
+ * other materials provided with the distribution.
+ * 3. Neither the name of the copyright holder nor the names of its contributors
+ * may be used to endorse or promote products derived from this software without
+ * specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+ * IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+ * BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+ * OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+ * WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY
+ * OF SUCH DAMAGE.
+ */
+
+package TtKVC
+
+import (
+	"errors"
+	tg "sot-te.ch/MTHelper"
+	"strconv"
+	"strings"
+)
+
+const (
+	tgKindVideo  = "video"
+	tgKindLink   = "link"
+	tgKindNotice = "notice"
+)
+
+func (cr *Observer) recordMessages(fileId int64, kind string, part int, msg string, chats []int64) {
+	for _, chat := range chats {
+		if err := cr.DB.AddTgMessage(chat, fileId, kind, part, msg); err != nil {
+			logger.Error(err)
+		}
+	}
+}
+
+func (cr *Observer) sendFileMsg(fileId int64, kind, msg string, chats []int64, formatted bool) {
+	cr.Telegram.Client.SendMsg(msg, chats, formatted)
+	cr.recordMessages(fileId, kind, 0, msg, chats)
+}
+
+func (cr *Observer) sendFileVideo(fileId int64, part int, video tg.MediaParams, msg string, chats []int64) int {
+	if len(chats) == 0 {
+		return 0
+	}
+	cr.Telegram.Client.SendVideo(video, msg, chats, true)
+	cr.recordMessages(fileId, tgKindVideo, part, msg, chats)
+	return len(chats)
+}
+
+func (cr *Observer) ResendFile(id, chat int64) error {
+	var err error
+	var file TorrentFile
+	if file, err = cr.DB.GetTorrentFile(id); err == nil {
+		if isEmpty(file.Name) {
+			err = errors.New("no such entry")
+		} else if file.Status != FileReadyStatus {
+			err = errors.New("file " + file.Name + " is not ready")
+		} else {
+			var chats []int64
+			if chat == 0 {
+				chats, err = cr.DB.GetFileMissingChats(file.Id)
+			} else {
+				chats = []int64{chat}
+			}
+			if err == nil {
+				if len(chats) == 0 {
+					err = errors.New("file " + file.Name + " already sent to all chats")
+				} else {
+					logger.Infof("Resending file %s to %d chat(s)", file.String(), len(chats))
+					go cr.sendTelegramVideo(file, chats)
+				}
+			}
+		}
+	}
+	return err
+}
+
+func (cr *Observer) cmdResendFile(chat int64, _, args string) error {
+	var err error
+	var id, target int64
+	var isAdmin bool
+	if isAdmin, err = cr.DB.GetAdminExist(chat); err == nil {
+		if isAdmin {
+			fields := strings.Fields(args)
+			if len(fields) == 0 {
+				err = errors.New("file id not set")
+			} else if id, err = strconv.ParseInt(fields[0], 10, 64); err == nil && len(fields) > 1 {
+				target, err = strconv.ParseInt(fields[1], 10, 64)
+			}
+			if err == nil {
+				err = cr.ResendFile(id, target)
+			}
+		} else {
+			logger.Infof("ResendFile unauthorized %d", chat)
+			cr.Telegram.Client.SendMsg(cr.Telegram.Messages.Unauthorized, []int64{chat}, false)
+		}
+	}
+	return err
+}
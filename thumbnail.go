@@ -0,0 +1,158 @@
+/*
+ * BSD-3-Clause
+ * Copyright 2020 sot (PR_713, C_rho_272)
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ * 1. Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ * this list of conditions and the following disclaimer in the documentation and/or
+ * other materials provided with the distribution.
+ * 3. Neither the name of the copyright holder nor the names of its contributors
+ * may be used to endorse or promote products derived from this software without
+ * specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+ * IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+ * BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+ * OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+ * WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY
+ * OF SUCH DAMAGE.
+ */
+
+package TtKVC
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	tg "sot-te.ch/MTHelper"
+	"strconv"
+)
+
+const (
+	defaultThumbnailSize = 320
+	defaultFFmpegPath    = "ffmpeg"
+	thumbnailDirectory   = "thumbnails"
+	thumbnailExt         = "jpg"
+)
+
+type ThumbnailConfig struct {
+	VidSec    uint   `json:"vidsec"`
+	MaxSize   uint   `json:"maxsize"`
+	FFmpeg    string `json:"ffmpeg"`
+	CachePath string `json:"cachepath"`
+}
+
+func thumbnailSize(width, height, maxSize uint) (uint, uint) {
+	if maxSize == 0 || maxSize > defaultThumbnailSize {
+		maxSize = defaultThumbnailSize
+	}
+	if width == 0 || height == 0 {
+		return maxSize, maxSize
+	}
+	if width >= height {
+		if width > maxSize {
+			height = height * maxSize / width
+			width = maxSize
+		}
+	} else if height > maxSize {
+		width = width * maxSize / height
+		height = maxSize
+	}
+	if width == 0 {
+		width = 1
+	}
+	if height == 0 {
+		height = 1
+	}
+	return width, height
+}
+
+func (c ThumbnailConfig) cacheDirectory(tempPath string) string {
+	if !isEmpty(c.CachePath) {
+		return c.CachePath
+	}
+	if isEmpty(tempPath) {
+		tempPath = os.TempDir()
+	}
+	return filepath.Join(tempPath, thumbnailDirectory)
+}
+
+func (c ThumbnailConfig) extractFrame(videoPath, dir string, width, height uint) (string, error) {
+	var err error
+	var tmpFile *os.File
+	var out []byte
+	ffmpeg := c.FFmpeg
+	if isEmpty(ffmpeg) {
+		ffmpeg = defaultFFmpegPath
+	}
+	if tmpFile, err = ioutil.TempFile(dir, "*."+thumbnailExt); err == nil {
+		tmpFileName := tmpFile.Name()
+		if err = tmpFile.Close(); err == nil {
+			cmd := exec.Command(ffmpeg, "-hide_banner", "-loglevel", "error",
+				"-ss", strconv.FormatUint(uint64(c.VidSec), 10), "-i", videoPath,
+				"-frames:v", "1", "-vf", fmt.Sprintf("scale=%d:%d", width, height), "-y", tmpFileName)
+			if out, err = cmd.CombinedOutput(); err != nil {
+				err = fmt.Errorf("ffmpeg: %v %s", err, out)
+			} else if stat, statErr := os.Stat(tmpFileName); statErr != nil || stat.Size() == 0 {
+				err = errors.New("ffmpeg: no frame extracted from " + videoPath)
+			}
+		}
+		if err != nil {
+			os.Remove(tmpFileName)
+		}
+		return tmpFileName, err
+	}
+	return "", err
+}
+
+func (cr *Observer) getThumbnail(id, thumbnailUrl string, width, height uint, videoPath string) (*tg.MediaParams, error) {
+	var err error
+	conf := cr.Telegram.Video.Thumbnail
+	thumbWidth, thumbHeight := thumbnailSize(width, height, conf.MaxSize)
+	dir := conf.cacheDirectory(cr.Telegram.Video.TempPath)
+	path := filepath.Join(dir, fmt.Sprintf("%s_%dx%d_%d.%s", id, thumbWidth, thumbHeight, conf.VidSec, thumbnailExt))
+	thumb := &tg.MediaParams{
+		Path:      path,
+		Width:     int32(thumbWidth),
+		Height:    int32(thumbHeight),
+		Streaming: false,
+	}
+	if stat, statErr := os.Stat(path); statErr == nil && stat.Size() > 0 {
+		logger.Debug("Using cached thumbnail", path)
+		return thumb, nil
+	}
+	if err = os.MkdirAll(dir, 0755); err == nil {
+		var tmpFileName string
+		if isEmpty(thumbnailUrl) {
+			err = errors.New("thumbnail url of " + id + " not set")
+		} else {
+			tmpFileName, err = downloadToDirectory(dir,
+				FormatThumbnailURL(thumbnailUrl, thumbWidth, thumbHeight, conf.VidSec), thumbnailExt)
+		}
+		if err != nil {
+			logger.Warning("Unable to download thumbnail, extracting locally:", err)
+			if !isEmpty(tmpFileName) {
+				os.Remove(tmpFileName)
+			}
+			tmpFileName, err = conf.extractFrame(videoPath, dir, thumbWidth, thumbHeight)
+		}
+		if err == nil {
+			if err = os.Rename(tmpFileName, path); err != nil {
+				os.Remove(tmpFileName)
+			}
+		}
+	}
+	if err != nil {
+		thumb = nil
+	}
+	return thumb, err
+}
@@ -0,0 +1,60 @@
+/*
+ * BSD-3-Clause
+ * Copyright 2020 sot (PR_713, C_rho_272)
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ * 1. Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ * this list of conditions and the following disclaimer in the documentation and/or
+ * other materials provided with the distribution.
+ * 3. Neither the name of the copyright holder nor the names of its contributors
+ * may be used to endorse or promote products derived from this software without
+ * specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+ * IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+ * BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+ * OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+ * WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY
+ * OF SUCH DAMAGE.
+ */
+
+package TtKVC
+
+import (
+	"testing"
+)
+
+func TestThumbnailSize(t *testing.T) {
+	tests := []struct {
+		name                string
+		width, height, max  uint
+		expWidth, expHeight uint
+	}{
+		{name: "landscape", width: 1920, height: 1080, expWidth: 320, expHeight: 180},
+		{name: "portrait", width: 1080, height: 1920, expWidth: 180, expHeight: 320},
+		{name: "square", width: 640, height: 640, expWidth: 320, expHeight: 320},
+		{name: "small", width: 160, height: 90, expWidth: 160, expHeight: 90},
+		{name: "lower max", width: 1920, height: 1080, max: 160, expWidth: 160, expHeight: 90},
+		{name: "max above cap", width: 1920, height: 1080, max: 640, expWidth: 320, expHeight: 180},
+		{name: "thin", width: 4000, height: 2, expWidth: 320, expHeight: 1},
+		{name: "zero width", width: 0, height: 1080, expWidth: 320, expHeight: 320},
+		{name: "zero height", width: 1920, height: 0, expWidth: 320, expHeight: 320},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			width, height := thumbnailSize(test.width, test.height, test.max)
+			if width != test.expWidth || height != test.expHeight {
+				t.Errorf("thumbnail size %dx%d, want %dx%d", width, height, test.expWidth, test.expHeight)
+			}
+			if width > defaultThumbnailSize || height > defaultThumbnailSize {
+				t.Error("thumbnail exceeds cap", width, height)
+			}
+		})
+	}
+}
@@ -28,13 +28,27 @@ package TtKVC
 
 import (
 	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"github.com/zeebo/bencode"
 	"io/ioutil"
 	"net/http"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 )
 
+const (
+	torrentMetaVersion2 = 2
+	fileTreeLeaf        = ""
+	fileTreeLength      = "length"
+	fileTreePiecesRoot  = "pieces root"
+	filePaddingAttr     = "p"
+)
+
 type Torrent struct {
 	AnnounceList [][]string `bencode:"announce-list"`
 	Announce     string     `bencode:"announce"`
@@ -49,27 +63,64 @@ type Torrent struct {
 		Files  []struct {
 			Length uint64   `bencode:"length"`
 			Path   []string `bencode:"path"`
+			Attr   string   `bencode:"attr"`
 		} `bencode:"files"`
-		Name        string `bencode:"name"`
-		PieceLength uint64 `bencode:"piece length"`
-		Pieces      []byte `bencode:"pieces"`
+		Name        string                 `bencode:"name"`
+		PieceLength uint64                 `bencode:"piece length"`
+		Pieces      []byte                 `bencode:"pieces"`
+		MetaVersion int64                  `bencode:"meta version"`
+		FileTree    map[string]interface{} `bencode:"file tree"`
 	} `bencode:"info"`
-	RawData []byte `bensode:"-"`
+	PieceLayers map[string]string `bencode:"piece layers"`
+	RawData     []byte            `bensode:"-"`
+	Magnet      *Magnet           `bencode:"-"`
+	InfoHash    string            `bencode:"-"`
+	InfoHashV2  string            `bencode:"-"`
+}
+
+type TorrentContent struct {
+	Path       []string
+	Length     uint64
+	PiecesRoot string
 }
 
-func GetTorrent(url string, reloadDelay uint) (*Torrent, error){
+func GetTorrent(url string, reloadDelay uint, limiter *RateLimiter, searchMagnet bool) (*Torrent, error) {
 	var res *Torrent
 	var err error
-	if res, err = getTorrent(url); err == nil && res != nil{
+	if strings.HasPrefix(url, magnetPrefix) {
+		return NewMagnetTorrent(url)
+	}
+	limiter.Wait(url)
+	if res, err = getTorrent(url, searchMagnet); err == nil && res != nil {
 		if reloadDelay > 0 {
 			time.Sleep(time.Duration(reloadDelay) * time.Second)
-			res, err = getTorrent(url)
+			limiter.Wait(url)
+			res, err = getTorrent(url, searchMagnet)
 		}
 	}
 	return res, err
 }
 
-func getTorrent(url string) (*Torrent, error) {
+func NewMagnetTorrent(uri string) (*Torrent, error) {
+	var err error
+	var res *Torrent
+	var magnet *Magnet
+	if magnet, err = ParseMagnet(uri); err == nil {
+		res = &Torrent{
+			Magnet:     magnet,
+			InfoHash:   magnet.InfoHash,
+			InfoHashV2: magnet.InfoHashV2,
+		}
+		if isEmpty(magnet.Name) {
+			res.Info.Name = magnet.InfoHash
+		} else {
+			res.Info.Name = magnet.Name
+		}
+	}
+	return res, err
+}
+
+func getTorrent(url string, searchMagnet bool) (*Torrent, error) {
 	var res *Torrent
 	var err error
 	if resp, httpErr := http.Get(url); checkResponse(resp, httpErr) {
@@ -82,7 +133,16 @@ func getTorrent(url string) (*Torrent, error) {
 				err := bencode.NewDecoder(bb).Decode(torrent)
 				if err == nil {
 					torrent.RawData = rawData
+					if torrent.InfoHash, torrent.InfoHashV2, err = infoHashes(rawData); err != nil {
+						logger.Warning(err)
+					}
 					res = torrent
+				} else if searchMagnet {
+					if magnet := findMagnet(rawData); !isEmpty(magnet) {
+						if res, err = NewMagnetTorrent(magnet); err != nil {
+							logger.Warning(err)
+						}
+					}
 				}
 			}
 		}
@@ -92,32 +152,149 @@ func getTorrent(url string) (*Torrent, error) {
 	return res, err
 }
 
-func (t *Torrent) FullSize() uint64 {
-	var fullLen uint64
-	if t.Info.Length > 0 {
-		fullLen = t.Info.Length
+func (t *Torrent) IsV2() bool {
+	return t.Info.MetaVersion >= torrentMetaVersion2 && len(t.Info.FileTree) > 0
+}
+
+func (t *Torrent) IsHybrid() bool {
+	return t.IsV2() && len(t.Info.Pieces) > 0
+}
+
+func (t *Torrent) Contents() []TorrentContent {
+	var contents []TorrentContent
+	if t.Magnet != nil {
+		return contents
+	}
+	if t.IsV2() {
+		var prefix []string
+		if !isSingleFileTree(t.Info.FileTree) {
+			prefix = []string{t.Info.Name}
+		}
+		contents = walkFileTree(t.Info.FileTree, prefix, contents)
+	} else if t.Info.Files != nil {
+		for _, file := range t.Info.Files {
+			if file.Path != nil && !strings.Contains(file.Attr, filePaddingAttr) {
+				allParts := []string{t.Info.Name}
+				allParts = append(allParts, file.Path...)
+				contents = append(contents, TorrentContent{
+					Path:   allParts,
+					Length: file.Length,
+				})
+			}
+		}
 	} else {
-		if t.Info.Files != nil {
-			for _, file := range t.Info.Files {
-				fullLen += file.Length
+		contents = append(contents, TorrentContent{
+			Path:   []string{t.Info.Name},
+			Length: t.Info.Length,
+		})
+	}
+	return contents
+}
+
+func isSingleFileTree(tree map[string]interface{}) bool {
+	if len(tree) == 1 {
+		for _, node := range tree {
+			if dir, ok := node.(map[string]interface{}); ok {
+				_, isFile := dir[fileTreeLeaf]
+				return isFile
+			}
+		}
+	}
+	return false
+}
+
+func walkFileTree(tree map[string]interface{}, prefix []string, contents []TorrentContent) []TorrentContent {
+	names := make([]string, 0, len(tree))
+	for name := range tree {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		node, ok := tree[name].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		path := make([]string, len(prefix), len(prefix)+1)
+		copy(path, prefix)
+		path = append(path, name)
+		if leaf, isFile := node[fileTreeLeaf].(map[string]interface{}); isFile {
+			content := TorrentContent{Path: path}
+			switch length := leaf[fileTreeLength].(type) {
+			case int64:
+				content.Length = uint64(length)
+			case uint64:
+				content.Length = length
 			}
+			if root, ok := leaf[fileTreePiecesRoot].(string); ok {
+				content.PiecesRoot = hex.EncodeToString([]byte(root))
+			}
+			contents = append(contents, content)
+		} else {
+			contents = walkFileTree(node, path, contents)
 		}
 	}
+	return contents
+}
+
+func (t *Torrent) PieceLayer(content TorrentContent) []byte {
+	var layer []byte
+	if root, err := hex.DecodeString(content.PiecesRoot); err == nil && len(root) > 0 {
+		layer = []byte(t.PieceLayers[string(root)])
+	}
+	return layer
+}
+
+func (t *Torrent) FullSize() uint64 {
+	var fullLen uint64
+	for _, content := range t.Contents() {
+		fullLen += content.Length
+	}
 	return fullLen
 }
 
 func (t *Torrent) Files() []string {
 	var files []string
-	if t.Info.Files != nil {
-		for _, file := range t.Info.Files {
-			if file.Path != nil {
-				allParts := []string{t.Info.Name}
-				allParts = append(allParts, file.Path...)
-				files = append(files, "/"+filepath.Join(allParts...))
+	for _, content := range t.Contents() {
+		files = append(files, content.Name())
+	}
+	return files
+}
+
+func (c TorrentContent) Name() string {
+	return "/" + filepath.Join(c.Path...)
+}
+
+func infoHash(metaInfo []byte) (string, error) {
+	hash, _, err := infoHashes(metaInfo)
+	return hash, err
+}
+
+func infoHashes(metaInfo []byte) (string, string, error) {
+	var err error
+	var hash, hashV2 string
+	raw := struct {
+		Info bencode.RawMessage `bencode:"info"`
+	}{}
+	if err = bencode.DecodeBytes(metaInfo, &raw); err == nil {
+		if len(raw.Info) == 0 {
+			err = errors.New("info dictionary not found")
+		} else {
+			info := struct {
+				MetaVersion int64  `bencode:"meta version"`
+				Pieces      []byte `bencode:"pieces"`
+			}{}
+			if err = bencode.DecodeBytes(raw.Info, &info); err == nil {
+				sum := sha1.Sum(raw.Info)
+				hash = hex.EncodeToString(sum[:])
+				if info.MetaVersion >= torrentMetaVersion2 {
+					sumV2 := sha256.Sum256(raw.Info)
+					hashV2 = hex.EncodeToString(sumV2[:])
+					if len(info.Pieces) == 0 {
+						hash = hashV2[:sha1.Size*2]
+					}
+				}
 			}
 		}
-	} else {
-		files = append(files, "/"+t.Info.Name)
 	}
-	return files
+	return hash, hashV2, err
 }
@@ -0,0 +1,89 @@
+/*
+ * BSD-3-Clause
+ * Copyright 2020 sot (PR_713, C_rho_272)
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ * 1. Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ * this list of conditions and the following disclaimer in the documentation and/or
+ * other materials provided with the distribution.
+ * 3. Neither the name of the copyright holder nor the names of its contributors
+ * may be used to endorse or promote products derived from this software without
+ * specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+ * IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+ * BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+ * OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+ * WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY
+ * OF SUCH DAMAGE.
+ */
+
+package TtKVC
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+type torrentGolden struct {
+	InfoHash   string   `json:"infoHash"`
+	InfoHashV2 string   `json:"infoHashV2"`
+	Files      []string `json:"files"`
+	FullSize   uint64   `json:"fullSize"`
+}
+
+func TestGetTorrentGolden(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer server.Close()
+	for _, test := range []struct {
+		name           string
+		isV2, isHybrid bool
+	}{
+		{"v1", false, false},
+		{"v2", true, false},
+		{"hybrid", true, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := ioutil.ReadFile("testdata/" + test.name + ".golden.json")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var golden torrentGolden
+			if err = json.Unmarshal(data, &golden); err != nil {
+				t.Fatal(err)
+			}
+			torrent, err := GetTorrent(server.URL+"/"+test.name+torrentExt, 0, nil, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if torrent == nil {
+				t.Fatal("torrent not decoded")
+			}
+			if torrent.IsV2() != test.isV2 || torrent.IsHybrid() != test.isHybrid {
+				t.Error("unexpected torrent version", torrent.IsV2(), torrent.IsHybrid())
+			}
+			if files := torrent.Files(); !reflect.DeepEqual(files, golden.Files) {
+				t.Errorf("unexpected files\nexpected: %q\nactual:   %q", golden.Files, files)
+			}
+			if size := torrent.FullSize(); size != golden.FullSize {
+				t.Error("unexpected size", size)
+			}
+			if torrent.InfoHash != golden.InfoHash {
+				t.Error("unexpected v1 info-hash", torrent.InfoHash)
+			}
+			if torrent.InfoHashV2 != golden.InfoHashV2 {
+				t.Error("unexpected v2 info-hash", torrent.InfoHashV2)
+			}
+		})
+	}
+}
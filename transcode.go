@@ -0,0 +1,250 @@
+/*
+ * BSD-3-Clause
+ * Copyright 2020 sot (PR_713, C_rho_272)
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ * 1. Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ * this list of conditions and the following disclaimer in the documentation and/or
+ * other materials provided with the distribution.
+ * 3. Neither the name of the copyright holder nor the names of its contributors
+ * may be used to endorse or promote products derived from this software without
+ * specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+ * IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+ * BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+ * OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+ * WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY
+ * OF SUCH DAMAGE.
+ */
+
+package TtKVC
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultFFprobePath     = "ffprobe"
+	defaultTranscodeName   = "default"
+	defaultTranscodeCodec  = "libx264"
+	defaultTranscodeAudio  = "aac"
+	defaultTranscodeCRF    = 23
+	localOutputExt         = "mp4"
+	localPartialExt        = ".part"
+	progressOutTimePrefix  = "out_time_us="
+	progressOutTimeMsAlias = "out_time_ms="
+	progressStep           = 0.01
+)
+
+type TranscodeProfile struct {
+	VideoCodec   string   `json:"videocodec"`
+	AudioCodec   string   `json:"audiocodec"`
+	Preset       string   `json:"preset"`
+	CRF          uint     `json:"crf"`
+	AudioBitrate string   `json:"audiobitrate"`
+	MaxWidth     uint     `json:"maxwidth"`
+	MaxHeight    uint     `json:"maxheight"`
+	FastStart    bool     `json:"faststart"`
+	Args         []string `json:"args"`
+}
+
+var defaultTranscodeProfile = TranscodeProfile{
+	VideoCodec:   defaultTranscodeCodec,
+	AudioCodec:   defaultTranscodeAudio,
+	Preset:       "veryfast",
+	CRF:          defaultTranscodeCRF,
+	AudioBitrate: "128k",
+	MaxWidth:     1920,
+	MaxHeight:    1080,
+	FastStart:    true,
+}
+
+func (p TranscodeProfile) scaleFilter() string {
+	width, height := "iw", "ih"
+	if p.MaxWidth > 0 {
+		width = strconv.FormatUint(uint64(p.MaxWidth), 10)
+	}
+	if p.MaxHeight > 0 {
+		height = strconv.FormatUint(uint64(p.MaxHeight), 10)
+	}
+	return fmt.Sprintf("scale='min(%s,iw)':'min(%s,ih)':force_original_aspect_ratio=decrease,"+
+		"scale=trunc(iw/2)*2:trunc(ih/2)*2", width, height)
+}
+
+func (p TranscodeProfile) args(input, output string) []string {
+	videoCodec, audioCodec, crf := p.VideoCodec, p.AudioCodec, p.CRF
+	if isEmpty(videoCodec) {
+		videoCodec = defaultTranscodeCodec
+	}
+	if isEmpty(audioCodec) {
+		audioCodec = defaultTranscodeAudio
+	}
+	if crf == 0 {
+		crf = defaultTranscodeCRF
+	}
+	args := []string{"-hide_banner", "-nostdin", "-nostats", "-loglevel", "error", "-progress", "pipe:1",
+		"-y", "-i", input, "-map", "0:v:0", "-map", "0:a:0?",
+		"-vf", p.scaleFilter(), "-c:v", videoCodec, "-crf", strconv.FormatUint(uint64(crf), 10), "-pix_fmt", "yuv420p"}
+	if !isEmpty(p.Preset) {
+		args = append(args, "-preset", p.Preset)
+	}
+	args = append(args, "-c:a", audioCodec)
+	if !isEmpty(p.AudioBitrate) {
+		args = append(args, "-b:a", p.AudioBitrate)
+	}
+	if p.FastStart {
+		args = append(args, "-movflags", "+faststart")
+	}
+	args = append(args, p.Args...)
+	return append(args, "-f", localOutputExt, output)
+}
+
+type localProcessor struct {
+	conf    VideoProcessorConfig
+	profile TranscodeProfile
+	ffmpeg  string
+	ffprobe string
+	db      *Database
+}
+
+func newLocalProcessor(conf VideoProcessorConfig, db *Database) (*localProcessor, error) {
+	if isEmpty(conf.Output) {
+		return nil, errors.New("local video processor output directory not set")
+	}
+	p := &localProcessor{
+		conf:    conf,
+		profile: defaultTranscodeProfile,
+		ffmpeg:  conf.FFmpeg,
+		ffprobe: conf.ffprobePath(),
+		db:      db,
+	}
+	if isEmpty(p.ffmpeg) {
+		p.ffmpeg = defaultFFmpegPath
+	}
+	name := conf.Profile
+	if isEmpty(name) {
+		name = defaultTranscodeName
+	}
+	if profile, found := conf.Profiles[name]; found {
+		p.profile = profile
+	} else if len(conf.Profiles) > 0 || name != defaultTranscodeName {
+		return nil, errors.New("transcode profile " + name + " not found")
+	}
+	return p, os.MkdirAll(conf.Output, 0755)
+}
+
+func (p *localProcessor) outputPath(file TorrentFile) string {
+	return filepath.Join(p.conf.Output, fmt.Sprintf("%d.%s", file.Id, localOutputExt))
+}
+
+func (p *localProcessor) transcode(file TorrentFile, input, output string) error {
+	var err error
+	media, probeErr := probeMedia(p.ffprobe, input)
+	duration := media.Duration
+	if probeErr != nil {
+		logger.Warning("Unable to get duration of", input, probeErr)
+	}
+	partial := output + localPartialExt
+	cmd := exec.Command(p.ffmpeg, p.profile.args(input, partial)...)
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	var stdout *bufio.Scanner
+	if pipe, pipeErr := cmd.StdoutPipe(); pipeErr == nil {
+		stdout = bufio.NewScanner(pipe)
+	} else {
+		return pipeErr
+	}
+	logger.Debugf("Transcoding %s to %s", input, output)
+	if err = cmd.Start(); err == nil {
+		var reported float64
+		for stdout.Scan() {
+			line := stdout.Text()
+			var value string
+			if strings.HasPrefix(line, progressOutTimePrefix) {
+				value = strings.TrimPrefix(line, progressOutTimePrefix)
+			} else if strings.HasPrefix(line, progressOutTimeMsAlias) {
+				value = strings.TrimPrefix(line, progressOutTimeMsAlias)
+			} else {
+				continue
+			}
+			if outTime, parseErr := strconv.ParseFloat(value, 64); parseErr == nil && duration > 0 {
+				progress := math.Min(outTime/1e6/duration, 1)
+				if progress-reported >= progressStep {
+					reported = progress
+					if dbErr := p.db.SetTorrentFileProgress(file.Id, FileConvertingStatus, progress); dbErr != nil {
+						logger.Error(dbErr)
+					}
+				}
+			}
+		}
+		if err = cmd.Wait(); err != nil {
+			err = fmt.Errorf("ffmpeg: %v %s", err, strings.TrimSpace(stderr.String()))
+		}
+	}
+	if err == nil {
+		err = os.Rename(partial, output)
+	}
+	if err != nil {
+		os.Remove(partial)
+	}
+	return err
+}
+
+func (p *localProcessor) Process(file TorrentFile, fullPath string, _ int64) (string, error) {
+	var err error
+	output := p.outputPath(file)
+	if err = p.db.SetTorrentFileProgress(file.Id, FileConvertingStatus, 0); err == nil {
+		err = p.transcode(file, fullPath, output)
+	}
+	return filepath.Base(output), err
+}
+
+func (p *localProcessor) IsReady(file TorrentFile) (bool, error) {
+	output := p.outputPath(file)
+	_, err := os.Stat(output)
+	if os.IsNotExist(err) {
+		logger.Warningf("Transcoded video of file %s not found, transcoding again", file.Name)
+		if rmErr := os.Remove(output + localPartialExt); rmErr != nil && !os.IsNotExist(rmErr) {
+			logger.Warning(rmErr)
+		}
+		return false, p.db.SetTorrentFileProgress(file.Id, FilePendingStatus, 0)
+	} else if err != nil {
+		return false, &processError{
+			msg: "transcoded video of file " + file.String() + " not available: " + err.Error(),
+		}
+	}
+	return true, nil
+}
+
+func (p *localProcessor) GetVideo(file TorrentFile) (ProcessedVideo, error) {
+	output := p.outputPath(file)
+	video := ProcessedVideo{
+		Id:   filepath.Base(output),
+		Path: output,
+	}
+	if !isEmpty(p.conf.URL) {
+		video.URL = strings.TrimSuffix(p.conf.URL, "/") + "/" + video.Id
+	}
+	if media, probeErr := probeMedia(p.ffprobe, output); probeErr == nil {
+		video.Width, video.Height, video.Duration = media.Width, media.Height, media.Duration
+	} else {
+		logger.Warning("Unable to get size of", output, probeErr)
+	}
+	return video, nil
+}
@@ -0,0 +1,72 @@
+/*
+ * BSD-3-Clause
+ * Copyright 2020 sot (PR_713, C_rho_272)
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ * 1. Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ * this list of conditions and the following disclaimer in the documentation and/or
+ * other materials provided with the distribution.
+ * 3. Neither the name of the copyright holder nor the names of its contributors
+ * may be used to endorse or promote products derived from this software without
+ * specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+ * IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+ * BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+ * OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+ * WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY
+ * OF SUCH DAMAGE.
+ */
+
+package TtKVC
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestLocalProcessorInterruptedTranscode(t *testing.T) {
+	cr, closeDB := testObserver(t)
+	defer closeDB()
+	output, err := ioutil.TempDir("", "ttkvc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(output)
+	p, err := newLocalProcessor(VideoProcessorConfig{Output: output}, &cr.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	video, _ := testSidecarFiles(t, cr, "local")
+	if err = cr.DB.SetTorrentFileProgress(video.Id, FileConvertingStatus, 0.5); err != nil {
+		t.Fatal(err)
+	}
+	partial := p.outputPath(video) + localPartialExt
+	if err = ioutil.WriteFile(partial, []byte("partial"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ready, err := p.IsReady(video)
+	if ready || err != nil {
+		t.Fatal("interrupted transcode must not fail", ready, err)
+	}
+	if _, err = os.Stat(partial); !os.IsNotExist(err) {
+		t.Error("stale partial output must be removed", err)
+	}
+	if file, err := cr.DB.GetTorrentFile(video.Id); err != nil || file.Status != FilePendingStatus || file.Progress != 0 {
+		t.Error("interrupted transcode must be queued again", file.Status, file.Progress, err)
+	}
+
+	if err = ioutil.WriteFile(p.outputPath(video), []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if ready, err = p.IsReady(video); !ready || err != nil {
+		t.Error("transcoded video must be ready", ready, err)
+	}
+}
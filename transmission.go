@@ -0,0 +1,198 @@
+/*
+ * BSD-3-Clause
+ * Copyright 2020 sot (PR_713, C_rho_272)
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ * 1. Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ * this list of conditions and the following disclaimer in the documentation and/or
+ * other materials provided with the distribution.
+ * 3. Neither the name of the copyright holder nor the names of its contributors
+ * may be used to endorse or promote products derived from this software without
+ * specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+ * IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+ * BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+ * OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+ * WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY
+ * OF SUCH DAMAGE.
+ */
+
+package TtKVC
+
+import (
+	"encoding/base64"
+	"errors"
+	tr "github.com/hekmon/transmissionrpc"
+	"strconv"
+)
+
+type transmissionClient struct {
+	client *tr.Client
+}
+
+func newTransmissionClient(conf TorrentClientConfig) (TorrentClient, error) {
+	t, err := tr.New(conf.Host, conf.Login, conf.Password, &tr.AdvancedConfig{
+		HTTPS: conf.Encryption,
+		Port:  conf.Port,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &transmissionClient{client: t}, nil
+}
+
+func parseTransmissionIds(ids []string) ([]int64, error) {
+	var err error
+	res := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		var i int64
+		if i, err = strconv.ParseInt(id, 10, 64); err == nil {
+			res = append(res, i)
+		} else {
+			break
+		}
+	}
+	return res, err
+}
+
+func convertTransmissionTorrent(torrent *tr.Torrent) ClientTorrent {
+	res := ClientTorrent{}
+	if torrent.ID != nil {
+		res.Id = strconv.FormatInt(*torrent.ID, 10)
+	}
+	if torrent.Name != nil {
+		res.Name = *torrent.Name
+	}
+	if torrent.HashString != nil {
+		res.Hash = *torrent.HashString
+	}
+	if torrent.PercentDone != nil {
+		res.Progress = *torrent.PercentDone
+	}
+	return res
+}
+
+func (t *transmissionClient) GetTorrents() ([]ClientTorrent, error) {
+	var err error
+	var res []ClientTorrent
+	var torrents []*tr.Torrent
+	if torrents, err = t.client.TorrentGet([]string{"id", "name", "hashString", "percentDone"}, nil); err == nil {
+		res = make([]ClientTorrent, 0, len(torrents))
+		for _, torrent := range torrents {
+			if torrent != nil && torrent.ID != nil {
+				res = append(res, convertTransmissionTorrent(torrent))
+			}
+		}
+	}
+	return res, err
+}
+
+func (t *transmissionClient) RemoveTorrents(ids []string) error {
+	var err error
+	var trIds []int64
+	if trIds, err = parseTransmissionIds(ids); err == nil && len(trIds) > 0 {
+		err = t.client.TorrentRemove(&tr.TorrentRemovePayload{
+			IDs:             trIds,
+			DeleteLocalData: false,
+		})
+	}
+	return err
+}
+
+func (t *transmissionClient) AddTorrent(metaInfo []byte, path string) (ClientTorrent, error) {
+	b64 := base64.StdEncoding.EncodeToString(metaInfo)
+	return t.add(&tr.TorrentAddPayload{
+		DownloadDir: &path,
+		MetaInfo:    &b64,
+		Paused:      new(bool),
+	})
+}
+
+func (t *transmissionClient) AddMagnet(uri string, path string) (ClientTorrent, error) {
+	return t.add(&tr.TorrentAddPayload{
+		DownloadDir: &path,
+		Filename:    &uri,
+		Paused:      new(bool),
+	})
+}
+
+func (t *transmissionClient) add(payload *tr.TorrentAddPayload) (ClientTorrent, error) {
+	var err error
+	var res ClientTorrent
+	var added *tr.Torrent
+	if added, err = t.client.TorrentAdd(payload); err == nil {
+		if added == nil || added.ID == nil {
+			err = errors.New("transmission: undefined add result")
+		} else {
+			res = convertTransmissionTorrent(added)
+		}
+	}
+	return res, err
+}
+
+func (t *transmissionClient) AddTrackers(ids []string, trackers []string) error {
+	var err error
+	var trIds []int64
+	if trIds, err = parseTransmissionIds(ids); err == nil && len(trIds) > 0 {
+		err = t.client.TorrentSet(&tr.TorrentSetPayload{
+			IDs:        trIds,
+			TrackerAdd: trackers,
+		})
+	}
+	return err
+}
+
+func (t *transmissionClient) GetProgress(id string) (float64, error) {
+	var err error
+	var res float64
+	var trIds []int64
+	if trIds, err = parseTransmissionIds([]string{id}); err == nil {
+		var torrents []*tr.Torrent
+		if torrents, err = t.client.TorrentGet([]string{"id", "percentDone"}, trIds); err == nil {
+			if len(torrents) == 0 || torrents[0] == nil || torrents[0].PercentDone == nil {
+				err = errors.New("transmission: torrent " + id + " not found")
+			} else {
+				res = *torrents[0].PercentDone
+			}
+		}
+	}
+	return res, err
+}
+
+func (t *transmissionClient) GetFiles(id string) ([]ClientFile, error) {
+	var err error
+	var res []ClientFile
+	var trIds []int64
+	if trIds, err = parseTransmissionIds([]string{id}); err == nil {
+		var torrents []*tr.Torrent
+		if torrents, err = t.client.TorrentGet([]string{"id", "files", "fileStats"}, trIds); err == nil {
+			if len(torrents) == 0 || torrents[0] == nil {
+				err = errors.New("transmission: torrent " + id + " not found")
+			} else {
+				res = make([]ClientFile, 0, len(torrents[0].Files))
+				for _, file := range torrents[0].Files {
+					if file != nil {
+						cf := ClientFile{
+							Name:   file.Name,
+							Length: file.Length,
+						}
+						if file.Length > 0 {
+							cf.Progress = float64(file.BytesCompleted) / float64(file.Length)
+						} else {
+							cf.Progress = 1
+						}
+						res = append(res, cf)
+					}
+				}
+			}
+		}
+	}
+	return res, err
+}
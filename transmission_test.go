@@ -0,0 +1,153 @@
+/*
+ * BSD-3-Clause
+ * Copyright 2020 sot (PR_713, C_rho_272)
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ * 1. Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ * this list of conditions and the following disclaimer in the documentation and/or
+ * other materials provided with the distribution.
+ * 3. Neither the name of the copyright holder nor the names of its contributors
+ * may be used to endorse or promote products derived from this software without
+ * specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+ * IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+ * BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+ * OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+ * WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY
+ * OF SUCH DAMAGE.
+ */
+
+package TtKVC
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+type fakeTransmission struct {
+	mutex     sync.Mutex
+	sessionId string
+	conflicts int
+	metaInfo  string
+	path      string
+}
+
+func (f *fakeTransmission) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if user, password, ok := r.BasicAuth(); !ok || user != "user" || password != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if r.Header.Get("X-Transmission-Session-Id") != f.sessionId {
+		f.conflicts++
+		w.Header().Set("X-Transmission-Session-Id", f.sessionId)
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	req := struct {
+		Method    string                 `json:"method"`
+		Arguments map[string]interface{} `json:"arguments"`
+		Tag       int                    `json:"tag"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	args := map[string]interface{}{}
+	torrent := map[string]interface{}{
+		"id":          42,
+		"name":        "test.mkv",
+		"hashString":  "abcdef",
+		"percentDone": 0.5,
+		"files": []map[string]interface{}{
+			{"name": "test/test.mkv", "length": 1024, "bytesCompleted": 512},
+		},
+	}
+	switch req.Method {
+	case "torrent-add":
+		f.metaInfo, _ = req.Arguments["metainfo"].(string)
+		f.path, _ = req.Arguments["download-dir"].(string)
+		args["torrent-added"] = map[string]interface{}{"id": 42, "name": "test.mkv", "hashString": "abcdef"}
+	case "torrent-get":
+		if len(f.metaInfo) > 0 {
+			args["torrents"] = []interface{}{torrent}
+		} else {
+			args["torrents"] = []interface{}{}
+		}
+	}
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"result":    "success",
+		"arguments": args,
+		"tag":       req.Tag,
+	})
+}
+
+func TestTransmissionClient(t *testing.T) {
+	fake := &fakeTransmission{sessionId: "first"}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	client, err := NewTorrentClient(testClientConfig(t, server, ClientTransmission))
+	if err != nil {
+		t.Fatal(err)
+	}
+	metaInfo, _ := testMetaInfo(t)
+	added, err := client.AddTorrent(metaInfo, "/download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added.Id != "42" || added.Hash != "abcdef" {
+		t.Error("unexpected added torrent", added)
+	}
+	if fake.metaInfo != base64.StdEncoding.EncodeToString(metaInfo) || fake.path != "/download" {
+		t.Error("unexpected add payload", fake.path)
+	}
+	if fake.conflicts != 1 {
+		t.Error("expected one session id conflict, got", fake.conflicts)
+	}
+	fake.mutex.Lock()
+	fake.sessionId = "second"
+	fake.mutex.Unlock()
+	torrents, err := client.GetTorrents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(torrents) != 1 || torrents[0].Id != "42" || torrents[0].Progress != 0.5 {
+		t.Error("unexpected torrents", torrents)
+	}
+	if fake.conflicts != 2 {
+		t.Error("expected session id renewal, conflicts:", fake.conflicts)
+	}
+	files, err := client.GetFiles("42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Name != "test/test.mkv" || files[0].Progress != 0.5 {
+		t.Error("unexpected files", files)
+	}
+}
+
+func TestTransmissionClientUnauthorized(t *testing.T) {
+	server := httptest.NewServer(&fakeTransmission{sessionId: "first"})
+	defer server.Close()
+	conf := testClientConfig(t, server, ClientTransmission)
+	conf.Password = "wrong"
+	client, err := NewTorrentClient(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.GetTorrents(); err == nil {
+		t.Error("expected authorization error")
+	}
+}
@@ -0,0 +1,157 @@
+/*
+ * BSD-3-Clause
+ * Copyright 2020 sot (PR_713, C_rho_272)
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ * 1. Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ * this list of conditions and the following disclaimer in the documentation and/or
+ * other materials provided with the distribution.
+ * 3. Neither the name of the copyright holder nor the names of its contributors
+ * may be used to endorse or promote products derived from this software without
+ * specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+ * IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+ * BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+ * OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+ * WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY
+ * OF SUCH DAMAGE.
+ */
+
+package TtKVC
+
+import (
+	"strings"
+)
+
+type torrentUpdate struct {
+	added   []TorrentFile
+	removed []TorrentFile
+	changed []TorrentFile
+}
+
+func (u torrentUpdate) isEmpty() bool {
+	return len(u.added) == 0 && len(u.removed) == 0 && len(u.changed) == 0
+}
+
+func torrentFiles(torrent *Torrent) []TorrentFile {
+	contents := torrent.Contents()
+	files := make([]TorrentFile, 0, len(contents))
+	for _, content := range contents {
+		files = append(files, TorrentFile{
+			Name:   content.Name(),
+			Length: content.Length,
+			Hash:   content.PiecesRoot,
+		})
+	}
+	return files
+}
+
+func isFileChanged(oldFile, newFile TorrentFile) bool {
+	return (oldFile.Length > 0 && newFile.Length > 0 && oldFile.Length != newFile.Length) ||
+		(!isEmpty(oldFile.Hash) && !isEmpty(newFile.Hash) && oldFile.Hash != newFile.Hash)
+}
+
+func diffTorrentFiles(oldFiles, newFiles []TorrentFile) torrentUpdate {
+	update := torrentUpdate{}
+	oldByName := make(map[string]TorrentFile, len(oldFiles))
+	for _, f := range oldFiles {
+		oldByName[f.Name] = f
+	}
+	newNames := make(map[string]bool, len(newFiles))
+	for _, f := range newFiles {
+		newNames[f.Name] = true
+		if oldFile, exist := oldByName[f.Name]; exist {
+			if isFileChanged(oldFile, f) {
+				update.changed = append(update.changed, oldFile)
+			}
+		} else {
+			update.added = append(update.added, f)
+		}
+	}
+	for _, f := range oldFiles {
+		if !newNames[f.Name] {
+			update.removed = append(update.removed, f)
+		}
+	}
+	return update
+}
+
+func joinFileNames(files []TorrentFile) string {
+	sb := strings.Builder{}
+	for _, f := range files {
+		sb.WriteString(f.Name)
+		sb.WriteRune('\n')
+	}
+	return sb.String()
+}
+
+func (cr *Observer) findPreviousRelease(src *Source, name, hash string, files []TorrentFile) int64 {
+	var err error
+	var ids []int64
+	if ids, err = cr.DB.GetTorrentsByName(name, src.id, hash); err == nil {
+		newNames := make(map[string]bool, len(files))
+		for _, f := range files {
+			newNames[f.Name] = true
+		}
+		for _, id := range ids {
+			var oldFiles []TorrentFile
+			if oldFiles, err = cr.DB.GetTorrentFiles(id); err != nil {
+				break
+			}
+			for _, f := range oldFiles {
+				if newNames[f.Name] {
+					logger.Debug("Found previous release of", name, "id", id)
+					return id
+				}
+			}
+		}
+	}
+	if err != nil {
+		logger.Error(err)
+	}
+	return TorrentInvalidId
+}
+
+func (cr *Observer) applyTorrentUpdate(name, hash string, oldFiles, newFiles []TorrentFile) {
+	var err error
+	update := diffTorrentFiles(oldFiles, newFiles)
+	if update.isEmpty() {
+		return
+	}
+	logger.Infof("Torrent %s updated, added: %d, removed: %d, changed: %d",
+		name, len(update.added), len(update.removed), len(update.changed))
+	for _, f := range update.removed {
+		if err = cr.DB.DelTorrentFile(f.Id); err != nil {
+			logger.Error(err)
+		}
+	}
+	for _, f := range update.changed {
+		if err = cr.DB.ResetTorrentFile(f.Id); err != nil {
+			logger.Error(err)
+		}
+	}
+	var admins []int64
+	if admins, err = cr.DB.GetAdmins(); err == nil && len(admins) > 0 {
+		var msg string
+		if msg, err = formatMessage(cr.Telegram.Messages.torrentUpdateTmpl, map[string]interface{}{
+			pName:    name,
+			pHash:    hash,
+			pAdded:   joinFileNames(update.added),
+			pRemoved: joinFileNames(update.removed),
+			pChanged: joinFileNames(update.changed),
+		}); err != nil {
+			msg = err.Error()
+		}
+		cr.Telegram.Client.SendMsg(msg, admins, true)
+	}
+	if err != nil {
+		logger.Error(err)
+	}
+}
@@ -0,0 +1,151 @@
+/*
+ * BSD-3-Clause
+ * Copyright 2020 sot (PR_713, C_rho_272)
+ * Redistribution and use in source and binary forms, with or without modification,
+ * are permitted provided that the following conditions are met:
+ * 1. Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ * 2. Redistributions in binary form must reproduce the above copyright notice,
+ * this list of conditions and the following disclaimer in the documentation and/or
+ * other materials provided with the distribution.
+ * 3. Neither the name of the copyright holder nor the names of its contributors
+ * may be used to endorse or promote products derived from this software without
+ * specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ * ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+ * IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+ * INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+ * BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+ * OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+ * WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ * ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY
+ * OF SUCH DAMAGE.
+ */
+
+package TtKVC
+
+import (
+	"reflect"
+	"testing"
+)
+
+func fileNames(files []TorrentFile) []string {
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+func TestDiffTorrentFiles(t *testing.T) {
+	oldFiles := []TorrentFile{
+		{Id: 1, Name: "/a.mkv", Length: 100, Hash: "aa"},
+		{Id: 2, Name: "/b.mkv", Length: 200},
+		{Id: 3, Name: "/c.mkv", Length: 300, Hash: "cc"},
+		{Id: 4, Name: "/d.mkv"},
+	}
+	tests := []struct {
+		name     string
+		newFiles []TorrentFile
+		added    []string
+		removed  []string
+		changed  []string
+	}{
+		{
+			name:     "same",
+			newFiles: []TorrentFile{{Name: "/a.mkv", Length: 100, Hash: "aa"}, {Name: "/b.mkv", Length: 200}, {Name: "/c.mkv", Length: 300, Hash: "cc"}, {Name: "/d.mkv", Length: 400}},
+		},
+		{
+			name:     "added",
+			newFiles: []TorrentFile{{Name: "/a.mkv", Length: 100, Hash: "aa"}, {Name: "/b.mkv", Length: 200}, {Name: "/c.mkv", Length: 300, Hash: "cc"}, {Name: "/d.mkv"}, {Name: "/e.mkv", Length: 500}},
+			added:    []string{"/e.mkv"},
+		},
+		{
+			name:     "removed",
+			newFiles: []TorrentFile{{Name: "/a.mkv", Length: 100, Hash: "aa"}, {Name: "/d.mkv"}},
+			removed:  []string{"/b.mkv", "/c.mkv"},
+		},
+		{
+			name:     "changed length",
+			newFiles: []TorrentFile{{Name: "/a.mkv", Length: 100, Hash: "aa"}, {Name: "/b.mkv", Length: 201}, {Name: "/c.mkv", Length: 300, Hash: "cc"}, {Name: "/d.mkv"}},
+			changed:  []string{"/b.mkv"},
+		},
+		{
+			name:     "changed hash",
+			newFiles: []TorrentFile{{Name: "/a.mkv", Length: 100, Hash: "ab"}, {Name: "/b.mkv", Length: 200, Hash: "bb"}, {Name: "/c.mkv", Length: 300}, {Name: "/d.mkv"}},
+			changed:  []string{"/a.mkv"},
+		},
+		{
+			name:     "all",
+			newFiles: []TorrentFile{{Name: "/a.mkv", Length: 101, Hash: "aa"}, {Name: "/d.mkv"}, {Name: "/f.mkv"}},
+			added:    []string{"/f.mkv"},
+			removed:  []string{"/b.mkv", "/c.mkv"},
+			changed:  []string{"/a.mkv"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			update := diffTorrentFiles(oldFiles, test.newFiles)
+			if names := fileNames(update.added); !reflect.DeepEqual(names, test.added) {
+				t.Error("unexpected added files", names)
+			}
+			if names := fileNames(update.removed); !reflect.DeepEqual(names, test.removed) {
+				t.Error("unexpected removed files", names)
+			}
+			if names := fileNames(update.changed); !reflect.DeepEqual(names, test.changed) {
+				t.Error("unexpected changed files", names)
+			}
+			if update.isEmpty() != (test.added == nil && test.removed == nil && test.changed == nil) {
+				t.Error("unexpected isEmpty", update.isEmpty())
+			}
+		})
+	}
+}
+
+func TestApplyTorrentUpdate(t *testing.T) {
+	cr, closeDB := testObserver(t)
+	defer closeDB()
+	source, err := cr.DB.AddSource("update", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := cr.DB.AddTorrent("Show", "", source, 0, []TorrentFile{
+		{Name: "/Show/1.mkv", Length: 100},
+		{Name: "/Show/2.mkv", Length: 200},
+		{Name: "/Show/3.mkv", Length: 300},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldFiles, err := cr.DB.GetTorrentFiles(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range oldFiles {
+		if err = cr.DB.SetTorrentFileStatus(f.Id, FileReadyStatus); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cr.applyTorrentUpdate("Show", "", oldFiles, []TorrentFile{
+		{Name: "/Show/1.mkv", Length: 100},
+		{Name: "/Show/2.mkv", Length: 250},
+		{Name: "/Show/4.mkv", Length: 400},
+	})
+	files, err := cr.DB.GetTorrentFiles(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := make(map[string]uint8, len(files))
+	for _, f := range files {
+		status[f.Name] = f.Status
+	}
+	expected := map[string]uint8{
+		"/Show/1.mkv": FileReadyStatus,
+		"/Show/2.mkv": FilePendingStatus,
+	}
+	if !reflect.DeepEqual(status, expected) {
+		t.Error("unexpected files after update", status)
+	}
+}